@@ -1,12 +1,16 @@
 package actions
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/lhopki01/git-mass-sync/debug"
 	"github.com/mitchellh/colorstring"
@@ -15,7 +19,54 @@ import (
 	"github.com/spf13/viper"
 )
 
-func (repos Repos) SyncRepos(dir string) {
+const (
+	cancelledMessage = "cancelled"
+	waitDelay        = 5 * time.Second
+	cleanupTimeout   = 30 * time.Second
+)
+
+// out is where progress and the results of operations are printed
+var out io.Writer = os.Stdout
+
+// SetOutput sets where progress and the results of operations are printed
+func SetOutput(w io.Writer) {
+	out = w
+}
+
+// operationContext returns the context for a single operation on a repo,
+// which is limited to --timeout if set.
+func operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := viper.GetDuration("timeout")
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// cleanupContext returns the context for undoing part of an operation, which
+// has to run even after the context of the operation timed out or was cancelled
+func cleanupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), cleanupTimeout)
+}
+
+// checkContext marks the repo as failed if ctx ended before the operation
+// running in it finished.
+func (repo *Repo) checkContext(ctx context.Context) {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		repo.fail(fmt.Sprintf("timed out after %s", viper.GetDuration("timeout")))
+	case context.Canceled:
+		repo.fail(cancelledMessage)
+	}
+}
+
+// addDuration adds the time since start to the time spent on the repo
+func (repo *Repo) addDuration(start time.Time) {
+	repo.Duration += time.Since(start)
+}
+
+func (repos Repos) SyncRepos(ctx context.Context, dir string) {
 	num := len(repos)
 	if num == 0 {
 		return
@@ -28,6 +79,7 @@ func (repos Repos) SyncRepos(dir string) {
 
 	bar := progressbar.NewOptions(
 		num,
+		progressbar.OptionSetWriter(out),
 		progressbar.OptionEnableColorCodes(true),
 		progressbar.OptionShowCount(),
 		progressbar.OptionSetDescription("[green]Syncing repos"),
@@ -35,24 +87,27 @@ func (repos Repos) SyncRepos(dir string) {
 
 	if verbose || dryRun {
 		//nolint:errcheck
-		colorstring.Println("[green]Syncing repos")
+		colorstring.Fprintln(out, "[green]Syncing repos")
 	} else {
 		err := bar.RenderBlank()
 		if err != nil {
-			fmt.Printf("Can't render progress bar")
+			fmt.Fprintf(out, "Can't render progress bar")
 		}
 	}
 
 	for _, repo := range repos {
 		if dryRun {
-			colorstring.Printf("[green]Would sync %s\n", repo.Name)
+			colorstring.Fprintf(out, "[green]Would sync %s\n", repo.Name)
 		} else {
-			swg.Add()
+			if swg.AddWithContext(ctx) != nil {
+				repo.fail(cancelledMessage)
+				continue
+			}
 			if verbose {
 				//nolint:errcheck
-				colorstring.Printf("[green]Syncing %s\n", repo.Name)
+				colorstring.Fprintf(out, "[green]Syncing %s\n", repo.Name)
 			}
-			go repo.syncRepo(dir, &swg, bar)
+			go repo.syncRepo(ctx, dir, &swg, bar)
 		}
 	}
 
@@ -61,151 +116,484 @@ func (repos Repos) SyncRepos(dir string) {
 	if !verbose || dryRun {
 		err := bar.Finish()
 		if err != nil {
-			fmt.Printf("Can't render progress bar finish")
+			fmt.Fprintf(out, "Can't render progress bar finish")
 		}
 
 		println("")
 	}
 }
 
-func (repo *Repo) syncRepo(dir string, swg *sizedwaitgroup.SizedWaitGroup, bar *progressbar.ProgressBar) {
-	cmd := exec.Command("hub", "sync")
-	cmd.Dir = fmt.Sprintf("%s/%s", dir, repo.Name)
-	output, err := cmd.CombinedOutput()
-	repo.Message = string(output)
-	debug.Debugf("Output of hub sync %s: %s", repo.Name, string(output))
+func (repo *Repo) syncRepo(ctx context.Context, dir string, swg *sizedwaitgroup.SizedWaitGroup, bar *progressbar.ProgressBar) {
+	defer swg.Done()
+	defer repo.addDuration(time.Now())
 
-	if strings.Contains(string(output), "warning: ") {
-		repo.Severity = Warning
+	strategy := Strategy(viper.GetString("strategy"))
+	if strategy == "" {
+		strategy = StrategyFFOnly
 	}
 
-	if err != nil {
-		repo.Severity = Error
-	}
+	opCtx, cancel := operationContext(ctx)
+	repo.sync(opCtx, fmt.Sprintf("%s/%s", dir, repo.Name), strategy)
+	repo.checkContext(opCtx)
+	repo.storeID(opCtx, fmt.Sprintf("%s/%s", dir, repo.Name))
+	cancel()
+	debug.Debugf("Output of sync %s: %s", repo.Name, repo.Message)
 
 	if !viper.GetBool("verbose") {
 		//nolint:gomnd
 		err := bar.Add(1)
 		if err != nil {
-			fmt.Printf("Can't add to progress bar")
+			fmt.Fprintf(out, "Can't add to progress bar")
 		}
 	}
-
-	swg.Done()
 }
 
-func (repos Repos) CloneRepos(dir string) {
+func (repos Repos) CloneRepos(ctx context.Context, dir string) {
 	swg := sizedwaitgroup.New(viper.GetInt("parallelism"))
 
 	for _, repo := range repos {
 		if viper.GetBool("dry-run") {
-			colorstring.Printf("[cyan]Would clone %s\n", repo.Name)
+			colorstring.Fprintf(out, "[cyan]Would clone %s\n", repo.Name)
 		} else {
-			swg.Add()
-			colorstring.Printf("[cyan]Cloning %s\n", repo.Name)
-			go repo.cloneRepo(dir, &swg)
+			if swg.AddWithContext(ctx) != nil {
+				repo.fail(cancelledMessage)
+				continue
+			}
+			colorstring.Fprintf(out, "[cyan]Cloning %s\n", repo.Name)
+			go repo.cloneRepo(ctx, dir, &swg)
 		}
 	}
 
 	swg.Wait()
 }
 
-func (repo *Repo) cloneRepo(dir string, swg *sizedwaitgroup.SizedWaitGroup) {
+func (repo *Repo) cloneRepo(ctx context.Context, dir string, swg *sizedwaitgroup.SizedWaitGroup) {
 	defer swg.Done()
+	defer repo.addDuration(time.Now())
 
-	//nolint:gosec
-	cmd := exec.Command("git", "clone", repo.SSHURL)
+	opCtx, cancel := operationContext(ctx)
+	defer cancel()
 
-	cmd.Dir = dir
-	output, err := cmd.CombinedOutput()
-	repo.Message = string(output)
+	repoDir := fmt.Sprintf("%s/%s", dir, repo.Name)
+
+	opts, err := repo.cloneOptions()
+	if err != nil {
+		repo.fail(err.Error())
+		return
+	}
+
+	args := append(append([]string{"clone"}, opts.args()...), repo.CloneURL(), repo.Name)
+	if viper.GetBool("mirror") {
+		args = []string{"clone", "--mirror", repo.CloneURL(), repo.Name}
+	}
+
+	output, attempts, err := withRetries(
+		opCtx,
+		repo.Name,
+		func() (string, error) {
+			output, err := gitCommand(opCtx, dir, args...).CombinedOutput()
+			return string(output), err
+		},
+		func() {
+			// Git normally cleans up after a failed clone but make sure
+			os.RemoveAll(repoDir)
+		},
+	)
+	repo.Message = output
+	repo.Attempts = attempts
 
 	debug.Debugf("Output of git clone %s: %s", repo.Name, output)
 
+	if err == nil && len(opts.Sparse) > 0 {
+		err = gitRun(opCtx, repoDir, append([]string{"sparse-checkout", "set"}, opts.Sparse...)...)
+		if err != nil {
+			repo.Message = fmt.Sprintf("cloned but unable to set sparse checkout: %s", err)
+		}
+	}
+
 	if err != nil {
 		repo.Severity = Error
+	} else {
+		repo.storeID(opCtx, repoDir)
+	}
+
+	if opCtx.Err() != nil {
+		// A killed clone leaves a partial repo behind that would be synced next time
+		os.RemoveAll(repoDir)
+		repo.checkContext(opCtx)
 	}
 }
 
-func (repos Repos) ArchiveRepos(dir, archiveDir string) {
+// ArchiveRepos moves repos from dir into archiveDir. It returns an error, and
+// fails every repo, if archiveDir can't be created.
+func (repos Repos) ArchiveRepos(ctx context.Context, dir, archiveDir string) error {
 	swg := sizedwaitgroup.New(viper.GetInt("parallelism"))
+	archived := make(chan ArchiveMetadata, len(repos))
 
-	if _, err := os.Stat(archiveDir); os.IsNotExist(err) {
+	if _, err := os.Stat(archiveDir); err != nil {
 		if viper.GetBool("dry-run") {
-			fmt.Printf("Would create archive dir %s if not exists\n", archiveDir)
+			fmt.Fprintf(out, "Would create archive dir %s if not exists\n", archiveDir)
 		} else {
-			fmt.Printf("Creating archiveDir %s\n", archiveDir)
+			fmt.Fprintf(out, "Creating archiveDir %s\n", archiveDir)
 			err := os.MkdirAll(archiveDir, 0755)
 			if err != nil {
-				//nolint:errcheck
-				colorstring.Println("[red]Failed to create archive dir")
-				//nolint:gomnd
-				os.Exit(1)
+				err = fmt.Errorf("unable to create archive dir %s: %s", archiveDir, err)
+
+				for _, repo := range repos {
+					repo.fail(err.Error())
+				}
+
+				return err
 			}
 		}
 	}
 
 	for _, repo := range repos {
 		if viper.GetBool("dry-run") {
-			colorstring.Printf("[light_magenta]Would archive %s in %s\n", repo.Name, archiveDir)
+			colorstring.Fprintf(out, "[light_magenta]Would archive %s (%s) in %s\n", repo.Name, repo.archiveReason(), archiveDir)
 		} else {
-			swg.Add()
-			colorstring.Printf("[light_magenta]Archiving %s in %s\n", repo.Name, archiveDir)
-			go repo.archiveRepo(dir, archiveDir, &swg)
+			if swg.AddWithContext(ctx) != nil {
+				repo.fail(cancelledMessage)
+				continue
+			}
+			colorstring.Fprintf(out, "[light_magenta]Archiving %s (%s) in %s\n", repo.Name, repo.archiveReason(), archiveDir)
+			go repo.archiveRepo(ctx, dir, archiveDir, &swg, archived)
 		}
 	}
 
 	swg.Wait()
+	close(archived)
+
+	var added []ArchiveMetadata
+	for metadata := range archived {
+		added = append(added, metadata)
+	}
+
+	if len(added) > 0 {
+		err := updateArchiveIndex(archiveDir, added, nil)
+		if err != nil {
+			colorstring.Fprintf(out, "[yellow]Unable to update the archive index: %s\n", err)
+		}
+	}
+
+	return nil
 }
 
-func (repo *Repo) archiveRepo(dir, archiveDir string, swg *sizedwaitgroup.SizedWaitGroup) {
+func (repo *Repo) archiveRepo(
+	ctx context.Context,
+	dir, archiveDir string,
+	swg *sizedwaitgroup.SizedWaitGroup,
+	archived chan<- ArchiveMetadata,
+) {
 	defer swg.Done()
+	defer repo.addDuration(time.Now())
 
-	err := os.Rename(
-		fmt.Sprintf("%s/%s", dir, repo.Name),
-		fmt.Sprintf("%s/%s", archiveDir, repo.Name),
-	)
+	opCtx, cancel := operationContext(ctx)
+	defer cancel()
+
+	repoDir := fmt.Sprintf("%s/%s", dir, repo.Name)
+
+	// Mirrors only ever hold what was fetched so there's nothing to lose
+	if _, err := os.Stat(repoDir); err == nil && !viper.GetBool("mirror") {
+		unsaved, err := unsavedWork(opCtx, repoDir)
+		if opCtx.Err() != nil {
+			repo.checkContext(opCtx)
+			return
+		}
+
+		if err != nil {
+			repo.Severity = Warning
+			repo.Message = fmt.Sprintf("not archiving as unable to check for unsaved work: %s", err)
+
+			return
+		}
+
+		if len(unsaved) > 0 {
+			repo.Severity = Warning
+			repo.Message = fmt.Sprintf("not archiving as it has %s", strings.Join(unsaved, ", "))
+
+			return
+		}
+	}
+
+	archivePath := fmt.Sprintf("%s/%s", archiveDir, repo.Name)
+	metadata := repo.archiveMetadata(opCtx, repoDir)
+
+	// Repos are nested in the archive dir in the same layout
+	err := os.MkdirAll(filepath.Dir(archivePath), 0755)
+	if err == nil {
+		if metadata.Format == ArchiveFormatDir {
+			err = os.Rename(repoDir, archivePath)
+		} else {
+			err = repo.pack(opCtx, repoDir, archivePath, metadata)
+		}
+	}
+
+	// The repo was archived even if the context ended just after
 	if err != nil {
+		if opCtx.Err() != nil {
+			repo.checkContext(opCtx)
+			return
+		}
+
 		repo.Severity = Error
 		repo.Message = err.Error()
+
+		return
 	}
+
+	archived <- metadata
 }
 
-func GetGitDirList(dir string) []string {
-	fmt.Printf("Getting existing git directory list")
+// UnarchiveRepos moves repos back from archiveDir into dir
+func (repos Repos) UnarchiveRepos(ctx context.Context, dir, archiveDir string) {
+	var restored []string
 
+	for _, repo := range repos {
+		if viper.GetBool("dry-run") {
+			colorstring.Fprintf(out, "[light_blue]Would unarchive %s from %s\n", repo.Name, archiveDir)
+			continue
+		}
+
+		if ctx.Err() != nil {
+			repo.fail(cancelledMessage)
+			continue
+		}
+
+		colorstring.Fprintf(out, "[light_blue]Unarchiving %s from %s\n", repo.Name, archiveDir)
+		repo.unarchive(dir, archiveDir)
+
+		if repo.Severity == Info {
+			restored = append(restored, repo.Name)
+		}
+	}
+
+	if len(restored) > 0 {
+		err := updateArchiveIndex(archiveDir, nil, restored)
+		if err != nil {
+			colorstring.Fprintf(out, "[yellow]Unable to update the archive index: %s\n", err)
+		}
+	}
+}
+
+func (repo *Repo) unarchive(dir, archiveDir string) {
+	defer repo.addDuration(time.Now())
+
+	err := moveDir(filepath.Join(archiveDir, repo.Name), filepath.Join(dir, repo.Name))
+	if err != nil {
+		repo.fail(fmt.Sprintf("not unarchiving as %s", err))
+	}
+}
+
+// unsavedWork describes any work in the repo at dir that would be lost, or at
+// least hard to find, if it were archived.
+func unsavedWork(ctx context.Context, dir string) ([]string, error) {
+	var unsaved []string
+
+	status, err := gitOutput(ctx, dir, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+
+	changes, untracked := 0, 0
+
+	for _, line := range status {
+		if strings.HasPrefix(line, "??") {
+			untracked++
+		} else {
+			changes++
+		}
+	}
+
+	if changes > 0 {
+		unsaved = append(unsaved, fmt.Sprintf("%d uncommitted changes", changes))
+	}
+
+	if untracked > 0 {
+		unsaved = append(unsaved, fmt.Sprintf("%d untracked files", untracked))
+	}
+
+	stashes, err := gitOutput(ctx, dir, "stash", "list")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stashes) > 0 {
+		unsaved = append(unsaved, fmt.Sprintf("%d stashes", len(stashes)))
+	}
+
+	// Commits on local branches that aren't on any remote branch, which covers
+	// branches ahead of their upstream and branches that were never pushed
+	unpushed, err := gitOutput(ctx, dir, "log", "--branches", "--not", "--remotes", "--format=%h")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(unpushed) > 0 {
+		unsaved = append(unsaved, fmt.Sprintf("%d unpushed commits", len(unpushed)))
+	}
+
+	return unsaved, nil
+}
+
+// gitCommand returns a git command that runs in dir and is killed if ctx ends
+func gitCommand(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+
+	if env := credentialEnv(); env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	// Children of git such as ssh can keep the output open after git is killed
+	cmd.WaitDelay = waitDelay
+
+	return cmd
+}
+
+// gitOutput runs a git command in dir and returns the non empty lines of its output
+func gitOutput(ctx context.Context, dir string, args ...string) ([]string, error) {
+	cmd := gitCommand(ctx, dir, args...)
+
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+
+		return nil, err
+	}
+
+	var lines []string
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, nil
+}
+
+// gitRun runs a git command in dir, discarding its output
+func gitRun(ctx context.Context, dir string, args ...string) error {
+	_, err := gitOutput(ctx, dir, args...)
+	return err
+}
+
+// GetGitDirList returns the paths of the git repos in dir relative to it. With
+// layouts other than flat, dirs that aren't git repos are searched for repos
+// too.
+func GetGitDirList(dir string) ([]string, error) {
+	return FindGitDirs(dir, Layout(viper.GetString("layout")).maxDepth())
+}
+
+// FindGitDirs returns the paths of the git repos in dir relative to it,
+// looking up to maxDepth dirs deep. Repos aren't looked for inside other
+// repos, hidden dirs, the archive dir or paths matching --ignore. It returns
+// an error if dir can't be read.
+func FindGitDirs(dir string, maxDepth int) ([]string, error) {
+	fmt.Fprintf(out, "Getting existing git directory list")
+
+	w := walker{
+		dir:    dir,
+		ignore: viper.GetStringSlice("ignore"),
+	}
+
+	if archiveDir := viper.GetString("archive-dir"); archiveDir != "" {
+		w.archiveDir = filepath.Clean(archiveDir)
+	}
+
+	dirList, err := w.find("", maxDepth)
+
+	if !viper.GetBool("verbose") || err != nil {
+		fmt.Fprintln(out, "")
+	}
+
+	return dirList, err
+}
+
+type walker struct {
+	dir        string
+	archiveDir string
+	// ignore are globs matched against the path and name of each dir
+	ignore []string
+}
+
+// find returns the git repos in rel, looking up to depth dirs deep. Dirs in
+// the download dir that can't be read are skipped, so only the download dir
+// itself not being readable is an error.
+func (w walker) find(rel string, depth int) ([]string, error) {
 	var dirList []string
 
-	files, err := ioutil.ReadDir(dir)
+	files, err := ioutil.ReadDir(filepath.Join(w.dir, rel))
 	if err != nil {
-		log.Fatal(err)
+		if rel == "" {
+			return nil, err
+		}
+
+		debug.Debugf("\n[%s] can't be read: %s", rel, err)
+
+		return nil, nil
 	}
 
 	for i, f := range files {
-		if i%100 == 0 && !viper.GetBool("verbose") {
-			fmt.Printf(".")
+		if rel == "" && i%100 == 0 && !viper.GetBool("verbose") {
+			fmt.Fprintf(out, ".")
 		}
 
-		if f.IsDir() {
-			cmd := exec.Command("git", "rev-parse")
-			cmd.Dir = fmt.Sprintf("%s/%s", dir, f.Name())
-			err = cmd.Run()
+		name := path.Join(rel, f.Name())
+
+		switch {
+		case !f.IsDir():
+			debug.Debugf("\n[%s] is not a directory", name)
+		case w.ignored(name):
+			debug.Debugf("\n[%s] is ignored", name)
+		case IsGitDir(filepath.Join(w.dir, name)):
+			dirList = append(dirList, name)
+		case depth > 1 && !strings.HasPrefix(f.Name(), "."):
+			nested, _ := w.find(name, depth-1)
+			dirList = append(dirList, nested...)
+		default:
+			debug.Debugf("\n[%s] is not a git directory", name)
+		}
+	}
 
-			if err == nil {
-				dirList = append(dirList, f.Name())
-			} else {
-				debug.Debugf("\n[%s] is not a git directory", f.Name())
-			}
-		} else {
-			debug.Debugf("\n[%s] is not a directory", f.Name())
+	return dirList, nil
+}
+
+func (w walker) ignored(name string) bool {
+	if w.archiveDir != "" && filepath.Join(w.dir, name) == w.archiveDir {
+		return true
+	}
+
+	for _, glob := range w.ignore {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+
+		if ok, _ := path.Match(glob, path.Base(name)); ok {
+			return true
 		}
 	}
 
-	if !viper.GetBool("verbose") {
-		fmt.Println("")
+	return false
+}
+
+// IsGitDir reports whether dir is the root of a git repo. Worktrees and
+// submodules have a .git file rather than a dir and bare repos have no .git
+// at all.
+func IsGitDir(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return true
+	}
+
+	for _, f := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			return false
+		}
 	}
 
-	return dirList
+	return true
 }
 
 func RemoveElementFromSlice(s []string, i int) []string {
@@ -1,6 +1,7 @@
 package actions
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -8,7 +9,9 @@ import (
 	"os/exec"
 	"sort"
 	"testing"
+	"time"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,7 +22,7 @@ func TestSyncRepos(t *testing.T) {
 			Name: "gitDir",
 		},
 	}
-	repos.SyncRepos(testDir)
+	repos.SyncRepos(context.Background(), testDir)
 	assert.Equal(t, "no git remotes found\n", repos[0].Message)
 	assert.Equal(t, Error, repos[0].Severity)
 	os.RemoveAll(testDir)
@@ -33,20 +36,73 @@ func TestCloneRepos(t *testing.T) {
 			SSHURL: "git@github.com/foo/bar.git",
 		},
 	}
-	repos.CloneRepos(testDir)
+	repos.CloneRepos(context.Background(), testDir)
 	//expectedFailures := []string{"[cyan]Cloning git@gitub.com/foo/bar.git: [red]exit status 128\nfatal: repository 'git@gitub.com/foo/bar.git' does not exist\n"}
 	assert.Equal(t, "fatal: repository 'git@github.com/foo/bar.git' does not exist\n", repos[0].Message)
 	assert.Equal(t, Error, repos[0].Severity)
 	os.RemoveAll(testDir)
 }
 
+func TestCloneReposStoresID(t *testing.T) {
+	testDir := CreateTestDirs()
+	defer os.RemoveAll(testDir)
+
+	repos := Repos{
+		&Repo{
+			Name:   "clone",
+			SSHURL: testDir + "/gitDir",
+			ID:     "github.com/1",
+		},
+	}
+	repos.CloneRepos(context.Background(), testDir)
+	assert.Equal(t, Info, repos[0].Severity)
+	assert.Equal(t, "github.com/1", RepoID(context.Background(), testDir+"/clone"))
+}
+
+func TestCloneReposTimeout(t *testing.T) {
+	testDir := CreateTestDirs()
+	defer os.RemoveAll(testDir)
+
+	viper.Set("timeout", time.Nanosecond)
+	defer viper.Set("timeout", 0)
+
+	repos := Repos{
+		&Repo{
+			Name:   "clone",
+			SSHURL: testDir + "/gitDir",
+		},
+	}
+	repos.CloneRepos(context.Background(), testDir)
+	assert.Equal(t, "timed out after 1ns", repos[0].Message)
+	assert.Equal(t, Error, repos[0].Severity)
+	assert.NoDirExists(t, testDir+"/clone")
+}
+
+func TestCloneReposCancelled(t *testing.T) {
+	testDir := CreateTestDirs()
+	defer os.RemoveAll(testDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	repos := Repos{
+		&Repo{
+			Name:   "clone",
+			SSHURL: testDir + "/gitDir",
+		},
+	}
+	repos.CloneRepos(ctx, testDir)
+	assert.Equal(t, "cancelled", repos[0].Message)
+	assert.Equal(t, Error, repos[0].Severity)
+}
+
 func TestArchiveRepos(t *testing.T) {
 	testDir := CreateTestDirs()
 	archiveDir := testDir + "/.archive"
 	repos := Repos{
 		&Repo{
-			Name:     "gitDir",
-			Archived: true,
+			Name:   "gitDir",
+			Reason: ReasonDeleted,
 		},
 		&Repo{
 			Name:     "nonExistantDir",
@@ -54,13 +110,87 @@ func TestArchiveRepos(t *testing.T) {
 		},
 	}
 
-	repos.ArchiveRepos(testDir, archiveDir)
+	assert.NoError(t, repos.ArchiveRepos(context.Background(), testDir, archiveDir))
 	expectedFailures := fmt.Sprintf("rename %s/nonExistantDir %s/.archive/nonExistantDir: no such file or directory", testDir, testDir)
 	assert.Equal(t, expectedFailures, repos[1].Message)
 	assert.DirExists(t, archiveDir+"/gitDir")
+
+	index, err := readArchiveIndex(archiveDir)
+	assert.NoError(t, err)
+	assert.Len(t, index, 1)
+	assert.Equal(t, "gitDir", index[0].Name)
+	assert.Equal(t, ReasonDeleted, index[0].Reason)
+	assert.Equal(t, ArchiveFormatDir, index[0].Format)
+
+	// Unarchiving a repo removes it from the index
+	Repos{{Name: "gitDir"}}.UnarchiveRepos(context.Background(), testDir, archiveDir)
+	index, err = readArchiveIndex(archiveDir)
+	assert.NoError(t, err)
+	assert.Empty(t, index)
 	os.RemoveAll(testDir)
 }
 
+func TestArchiveReposNoArchiveDir(t *testing.T) {
+	testDir := CreateTestDirs()
+	defer os.RemoveAll(testDir)
+
+	// The archive dir can't be created inside a file
+	archiveDir := testDir + "/file/.archive"
+	repos := Repos{{Name: "gitDir"}}
+
+	err := repos.ArchiveRepos(context.Background(), testDir, archiveDir)
+	expected := fmt.Sprintf("unable to create archive dir %s: mkdir %s/file: not a directory", archiveDir, testDir)
+	assert.EqualError(t, err, expected)
+	assert.Equal(t, Error, repos[0].Severity)
+	assert.Equal(t, expected, repos[0].Message)
+	assert.DirExists(t, testDir+"/gitDir")
+}
+
+func TestArchiveReposUnsavedWork(t *testing.T) {
+	testDir := CreateTestDirs()
+	defer os.RemoveAll(testDir)
+
+	_, err := os.Create(testDir + "/gitDir/wip")
+	assert.NoError(t, err)
+
+	archiveDir := testDir + "/.archive"
+	repos := Repos{
+		&Repo{
+			Name: "gitDir",
+		},
+	}
+
+	repos.ArchiveRepos(context.Background(), testDir, archiveDir)
+	assert.Equal(t, Warning, repos[0].Severity)
+	assert.Equal(t, "not archiving as it has 1 untracked files", repos[0].Message)
+	assert.DirExists(t, testDir+"/gitDir")
+	assert.NoDirExists(t, archiveDir+"/gitDir")
+}
+
+func TestUnarchiveRepos(t *testing.T) {
+	testDir := CreateTestDirs()
+	defer os.RemoveAll(testDir)
+
+	archiveDir := testDir + "/.archive"
+	assert.NoError(t, os.MkdirAll(archiveDir, 0755))
+	assert.NoError(t, os.Rename(testDir+"/gitDir", archiveDir+"/gitDir"))
+	assert.NoError(t, os.MkdirAll(archiveDir+"/notGitDir", 0755))
+
+	repos := Repos{
+		{Name: "gitDir"},
+		{Name: "notGitDir"},
+	}
+	repos.UnarchiveRepos(context.Background(), testDir, archiveDir)
+
+	assert.Equal(t, Info, repos[0].Severity)
+	assert.DirExists(t, testDir+"/gitDir")
+	assert.NoDirExists(t, archiveDir+"/gitDir")
+
+	assert.Equal(t, Error, repos[1].Severity)
+	assert.Equal(t, "not unarchiving as "+testDir+"/notGitDir already exists", repos[1].Message)
+	assert.DirExists(t, archiveDir+"/notGitDir")
+}
+
 func CreateTestDirs() string {
 	dir, err := ioutil.TempDir("", "git-mass-sync")
 	if err != nil {
@@ -92,8 +222,14 @@ func CreateTestDirs() string {
 
 func TestGetDirList(t *testing.T) {
 	testDir := CreateTestDirs()
-	assert.Equal(t, []string{"gitDir"}, GetGitDirList(testDir))
-	os.RemoveAll(testDir)
+	defer os.RemoveAll(testDir)
+
+	dirs, err := GetGitDirList(testDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gitDir"}, dirs)
+
+	_, err = GetGitDirList(testDir + "/missing")
+	assert.Error(t, err)
 }
 
 func TestRemoveElementFromSlice(t *testing.T) {
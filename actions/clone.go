@@ -0,0 +1,76 @@
+package actions
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// CloneOptions limit how much of a repo is cloned
+type CloneOptions struct {
+	// Depth is how many commits of history to clone, 0 clones all of them
+	Depth int `mapstructure:"depth"`
+	// Filter is a partial clone filter such as blob:none
+	Filter       string `mapstructure:"filter"`
+	SingleBranch bool   `mapstructure:"single-branch"`
+	// Sparse are the dirs checked out with sparse checkout
+	Sparse []string `mapstructure:"sparse"`
+}
+
+// cloneOptions returns the clone options for the repo, which are the flags
+// overridden by any settings for the repo under repos in the config files
+func (repo *Repo) cloneOptions() (CloneOptions, error) {
+	opts := CloneOptions{
+		Depth:        viper.GetInt("depth"),
+		Filter:       viper.GetString("filter"),
+		SingleBranch: viper.GetBool("single-branch"),
+		// Copied as decoding the settings for the repo reuses the slice
+		Sparse: append([]string(nil), viper.GetStringSlice("sparse")...),
+	}
+
+	// Viper lowercases keys. Repos are looked up by their path in the layout
+	// and then by their name.
+	repos := viper.GetStringMap("repos")
+
+	for _, name := range []string{repo.Name, BaseName(repo.Name)} {
+		settings, ok := repos[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+
+		err := mapstructure.WeakDecode(settings, &opts)
+		if err != nil {
+			return opts, fmt.Errorf("invalid clone options for %s in config: %s", name, err)
+		}
+
+		break
+	}
+
+	return opts, nil
+}
+
+// args returns the options for git clone
+func (opts CloneOptions) args() []string {
+	var args []string
+
+	if opts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(opts.Depth))
+	}
+
+	if opts.Filter != "" {
+		args = append(args, "--filter="+opts.Filter)
+	}
+
+	if opts.SingleBranch {
+		args = append(args, "--single-branch")
+	}
+
+	if len(opts.Sparse) > 0 {
+		args = append(args, "--sparse")
+	}
+
+	return args
+}
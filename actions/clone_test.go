@@ -0,0 +1,71 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneOptions(t *testing.T) {
+	viper.Set("depth", 10)
+	viper.Set("sparse", []string{"docs"})
+	viper.Set("repos", map[string]interface{}{
+		"monorepo": map[string]interface{}{"depth": 1, "filter": "blob:none", "sparse": "services/api"},
+		"foo/docs": map[string]interface{}{"single-branch": true},
+		"broken":   map[string]interface{}{"depth": "all"},
+	})
+	defer func() {
+		viper.Set("depth", 0)
+		viper.Set("sparse", nil)
+		viper.Set("repos", nil)
+	}()
+
+	opts, err := (&Repo{Name: "foo/monorepo"}).cloneOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, CloneOptions{Depth: 1, Filter: "blob:none", Sparse: []string{"services/api"}}, opts)
+	assert.Equal(t, []string{"--depth", "1", "--filter=blob:none", "--sparse"}, opts.args())
+
+	opts, err = (&Repo{Name: "foo/docs"}).cloneOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, CloneOptions{Depth: 10, SingleBranch: true, Sparse: []string{"docs"}}, opts)
+
+	opts, err = (&Repo{Name: "bar/docs"}).cloneOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, CloneOptions{Depth: 10, Sparse: []string{"docs"}}, opts)
+
+	_, err = (&Repo{Name: "broken"}).cloneOptions()
+	assert.Error(t, err)
+}
+
+func TestCloneReposShallowSparse(t *testing.T) {
+	testDir, _ := createSyncTestRepos(t)
+	defer os.RemoveAll(testDir)
+
+	upstream := testDir + "/upstream"
+	assert.NoError(t, os.MkdirAll(upstream+"/api", 0755))
+	assert.NoError(t, os.MkdirAll(upstream+"/web", 0755))
+	commit(t, upstream, "api/main.go")
+	commit(t, upstream, "web/index.html")
+	runGit(t, upstream, "push", "-q", "origin", "main")
+
+	viper.Set("depth", 1)
+	viper.Set("sparse", []string{"api"})
+	defer func() {
+		viper.Set("depth", 0)
+		viper.Set("sparse", nil)
+	}()
+
+	// Depth is ignored when cloning from a local path
+	repos := Repos{{Name: "clone", SSHURL: "file://" + testDir + "/remote.git"}}
+	repos.CloneRepos(context.Background(), testDir)
+	assert.Equal(t, Info, repos[0].Severity, repos[0].Message)
+
+	commits, err := gitOutput(context.Background(), testDir+"/clone", "rev-list", "--count", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, commits)
+	assert.FileExists(t, testDir+"/clone/api/main.go")
+	assert.NoFileExists(t, testDir+"/clone/web/index.html")
+}
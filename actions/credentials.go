@@ -0,0 +1,201 @@
+package actions
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/lhopki01/git-mass-sync/debug"
+	"github.com/spf13/viper"
+)
+
+// Protocol decides which url repos are cloned and fetched with
+type Protocol string
+
+const (
+	// ProtocolSSH uses the ssh url of repos and the user's ssh keys
+	ProtocolSSH Protocol = "ssh"
+	// ProtocolHTTPS uses the https url of repos and the provider token
+	ProtocolHTTPS Protocol = "https"
+)
+
+var protocols = []Protocol{ProtocolSSH, ProtocolHTTPS}
+
+// The askpass shim is this binary run by git with these env vars set, so the
+// token is only ever held in the environment of git and never written to disk
+const (
+	askpassEnv         = "GIT_MASS_SYNC_ASKPASS"
+	askpassUsernameEnv = "GIT_MASS_SYNC_USERNAME"
+	askpassTokenEnv    = "GIT_MASS_SYNC_TOKEN"
+	askpassHostEnv     = "GIT_MASS_SYNC_HOST"
+)
+
+// Credentials are given to git when cloning and fetching over https
+type Credentials struct {
+	Username string
+	Token    string
+	// Host is the only host the token is given to, so other remotes of a
+	// repo never see it
+	Host string
+}
+
+// credentials are used by every git command when the protocol is https
+var credentials Credentials
+
+// askpass is the path of this binary for git to run as GIT_ASKPASS
+var askpass string
+
+// ParseProtocol returns the Protocol named s, which defaults to ssh
+func ParseProtocol(s string) (Protocol, error) {
+	if s == "" {
+		return ProtocolSSH, nil
+	}
+
+	for _, protocol := range protocols {
+		if Protocol(s) == protocol {
+			return protocol, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown protocol [%s], must be one of %v", s, protocols)
+}
+
+func protocol() Protocol {
+	p, _ := ParseProtocol(viper.GetString("protocol"))
+	return p
+}
+
+// SetCredentials sets the credentials git is given over https. Without a
+// token git falls back to any credential helper the user has configured.
+func SetCredentials(c Credentials) {
+	credentials = c
+
+	if c.Token == "" || askpass != "" {
+		return
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		debug.Debugf("unable to find the askpass shim: %s", err)
+		return
+	}
+
+	askpass = exe
+}
+
+// credentialEnv returns the env vars that let git ask this binary for the
+// credentials, if there are any to give
+func credentialEnv() []string {
+	if protocol() != ProtocolHTTPS {
+		return nil
+	}
+
+	// Fail rather than hang waiting for a username that will never be typed
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+
+	if credentials.Token != "" && askpass != "" {
+		env = append(
+			env,
+			"GIT_ASKPASS="+askpass,
+			askpassEnv+"=1",
+			askpassUsernameEnv+"="+credentials.Username,
+			askpassTokenEnv+"="+credentials.Token,
+			askpassHostEnv+"="+credentials.Host,
+		)
+	}
+
+	return env
+}
+
+// RunAskpass answers the prompt git gives GIT_ASKPASS with the username or
+// token if this binary was run as the askpass shim. It reports whether it was,
+// and returns an error rather than answer a prompt for any other host.
+func RunAskpass(args []string) (bool, error) {
+	if os.Getenv(askpassEnv) == "" {
+		return false, nil
+	}
+
+	var prompt string
+	if len(args) > 1 {
+		prompt = args[1]
+	}
+
+	// Ports are ignored as git leaves out the default one
+	allowed := (&url.URL{Host: os.Getenv(askpassHostEnv)}).Hostname()
+
+	host := promptHost(prompt)
+	if host == "" || !strings.EqualFold(host, allowed) {
+		return true, fmt.Errorf("not giving the token for %s to [%s]", allowed, host)
+	}
+
+	if strings.HasPrefix(prompt, "Username") {
+		fmt.Println(os.Getenv(askpassUsernameEnv))
+	} else {
+		fmt.Println(os.Getenv(askpassTokenEnv))
+	}
+
+	return true, nil
+}
+
+// promptHost returns the host of the url in a git credential prompt such as
+// "Password for 'https://user@github.com': "
+func promptHost(prompt string) string {
+	start := strings.Index(prompt, "'")
+	end := strings.LastIndex(prompt, "'")
+	if start == end {
+		return ""
+	}
+
+	u, err := url.Parse(prompt[start+1 : end])
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+// CloneURL returns the url to clone the repo with, which is its templated url
+// if it has one or else its url for the protocol
+func (repo *Repo) CloneURL() string {
+	switch {
+	case repo.URL != "":
+		return repo.URL
+	case protocol() == ProtocolHTTPS && repo.HTTPSURL != "":
+		return repo.HTTPSURL
+	}
+
+	return repo.SSHURL
+}
+
+// HasURL reports whether url is one of the urls of the repo
+func (repo *Repo) HasURL(url string) bool {
+	for _, u := range []string{repo.URL, repo.SSHURL, repo.HTTPSURL} {
+		if u != "" && SameURL(url, u) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// urlRewrites returns git options that make remotes cloned with another url
+// of the repo fetch with its clone url instead. Remotes are only rewritten if
+// the url was chosen with a template or --protocol, as otherwise they may be
+// relying on ssh keys or a credential helper for the url they were cloned with.
+func (repo *Repo) urlRewrites() []string {
+	url := repo.CloneURL()
+	if url == "" || (repo.URL == "" && viper.GetString("protocol") == "") {
+		return nil
+	}
+
+	var rewrites []string
+
+	for _, other := range []string{repo.SSHURL, repo.HTTPSURL} {
+		if other != "" && other != url {
+			rewrites = append(rewrites, "-c", fmt.Sprintf("url.%s.insteadOf=%s", url, other))
+		}
+	}
+
+	return rewrites
+}
@@ -0,0 +1,130 @@
+package actions
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneURL(t *testing.T) {
+	repo := &Repo{SSHURL: "git@github.com:foo/bar.git", HTTPSURL: "https://github.com/foo/bar.git"}
+	local := &Repo{SSHURL: "git@github.com:foo/local.git"}
+
+	assert.Equal(t, "git@github.com:foo/bar.git", repo.CloneURL())
+	// Remotes cloned over https keep fetching over https unless asked not to
+	assert.Nil(t, repo.urlRewrites())
+	assert.Nil(t, credentialEnv())
+
+	viper.Set("protocol", "ssh")
+	defer viper.Set("protocol", "")
+
+	assert.Equal(t, "git@github.com:foo/bar.git", repo.CloneURL())
+	assert.Equal(t, []string{"-c", "url.git@github.com:foo/bar.git.insteadOf=https://github.com/foo/bar.git"}, repo.urlRewrites())
+	assert.Nil(t, credentialEnv())
+
+	viper.Set("protocol", "https")
+
+	assert.Equal(t, "https://github.com/foo/bar.git", repo.CloneURL())
+	assert.Equal(t, []string{"-c", "url.https://github.com/foo/bar.git.insteadOf=git@github.com:foo/bar.git"}, repo.urlRewrites())
+	assert.Equal(t, "git@github.com:foo/local.git", local.CloneURL())
+	assert.Nil(t, local.urlRewrites())
+
+	assert.True(t, repo.HasURL("https://github.com/Foo/bar"))
+	assert.False(t, local.HasURL(""))
+
+	templated := &Repo{SSHURL: "git@github.com:foo/bar.git", HTTPSURL: "https://github.com/foo/bar.git", URL: "git@github-work:foo/bar.git"}
+	assert.Equal(t, "git@github-work:foo/bar.git", templated.CloneURL())
+	assert.Equal(t, []string{
+		"-c", "url.git@github-work:foo/bar.git.insteadOf=git@github.com:foo/bar.git",
+		"-c", "url.git@github-work:foo/bar.git.insteadOf=https://github.com/foo/bar.git",
+	}, templated.urlRewrites())
+	assert.True(t, templated.HasURL("git@github-work:foo/bar"))
+
+	_, err := ParseProtocol("git")
+	assert.EqualError(t, err, "unknown protocol [git], must be one of [ssh https]")
+}
+
+func TestCredentialEnv(t *testing.T) {
+	viper.Set("protocol", "https")
+	defer viper.Set("protocol", "")
+
+	defer SetCredentials(Credentials{})
+
+	SetCredentials(Credentials{})
+	assert.Equal(t, []string{"GIT_TERMINAL_PROMPT=0"}, credentialEnv())
+
+	SetCredentials(Credentials{Username: "x-access-token", Token: "secret", Host: "github.com"})
+	exe, err := os.Executable()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_ASKPASS=" + exe,
+		"GIT_MASS_SYNC_ASKPASS=1",
+		"GIT_MASS_SYNC_USERNAME=x-access-token",
+		"GIT_MASS_SYNC_TOKEN=secret",
+		"GIT_MASS_SYNC_HOST=github.com",
+	}, credentialEnv())
+}
+
+func TestRunAskpass(t *testing.T) {
+	askpass, err := RunAskpass([]string{"git-mass-sync", "Password for 'https://github.com': "})
+	assert.False(t, askpass)
+	assert.NoError(t, err)
+
+	for env, value := range map[string]string{askpassEnv: "1", askpassTokenEnv: "secret", askpassHostEnv: "github.com"} {
+		os.Setenv(env, value)
+		defer os.Unsetenv(env)
+	}
+
+	askpass, err = RunAskpass([]string{"git-mass-sync", "Password for 'https://x-access-token@GitHub.com': "})
+	assert.True(t, askpass)
+	assert.NoError(t, err)
+
+	// Other remotes of the repo must never be given the token
+	askpass, err = RunAskpass([]string{"git-mass-sync", "Password for 'https://u@evil.example.com': "})
+	assert.True(t, askpass)
+	assert.EqualError(t, err, "not giving the token for github.com to [evil.example.com]")
+
+	_, err = RunAskpass([]string{"git-mass-sync"})
+	assert.EqualError(t, err, "not giving the token for github.com to []")
+}
+
+func TestSyncReposProtocol(t *testing.T) {
+	testDir, local := createSyncTestRepos(t)
+	defer os.RemoveAll(testDir)
+
+	// Only the https url of the repo can be fetched from
+	runGit(t, local, "remote", "set-url", "origin", "git@example.invalid:foo/local.git")
+	repos := Repos{{Name: "local", SSHURL: "git@example.invalid:foo/local.git", HTTPSURL: testDir + "/remote.git"}}
+
+	viper.Set("strategy", "fetch")
+	defer viper.Set("strategy", "")
+	viper.Set("retries", 0)
+	defer viper.Set("retries", 0)
+
+	repos.SyncRepos(context.Background(), testDir)
+	assert.Equal(t, Error, repos[0].Severity)
+
+	// Without --protocol remotes are fetched with the url they were cloned with
+	runGit(t, local, "remote", "set-url", "origin", testDir+"/remote.git")
+	repos = Repos{{Name: "local", SSHURL: "git@example.invalid:foo/local.git", HTTPSURL: testDir + "/remote.git"}}
+	repos.SyncRepos(context.Background(), testDir)
+	assert.NotEqual(t, Error, repos[0].Severity, repos[0].Message)
+
+	runGit(t, local, "remote", "set-url", "origin", "git@example.invalid:foo/local.git")
+	viper.Set("protocol", "https")
+	defer viper.Set("protocol", "")
+
+	repos = Repos{{Name: "local", SSHURL: "git@example.invalid:foo/local.git", HTTPSURL: testDir + "/remote.git"}}
+	repos.SyncRepos(context.Background(), testDir)
+	assert.NotEqual(t, Error, repos[0].Severity, repos[0].Message)
+
+	// The rewrite is never saved in the repo
+	config, err := ioutil.ReadFile(local + "/.git/config")
+	assert.NoError(t, err)
+	assert.NotContains(t, string(config), "insteadOf")
+}
@@ -0,0 +1,73 @@
+package actions
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// archiveIndexFile lists every repo in the archive dir and why it was
+// archived. It is hidden to keep it apart from the archived repos.
+const archiveIndexFile = ".gms-index.json"
+
+type archiveIndex struct {
+	Repos []ArchiveMetadata `json:"repos"`
+}
+
+// readArchiveIndex returns the repos recorded in the index of archiveDir,
+// which has none if nothing has been archived since the index was added
+func readArchiveIndex(archiveDir string) ([]ArchiveMetadata, error) {
+	b, err := ioutil.ReadFile(filepath.Join(archiveDir, archiveIndexFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var index archiveIndex
+
+	err = json.Unmarshal(b, &index)
+
+	return index.Repos, err
+}
+
+// updateArchiveIndex adds repos to and removes the repos named in removed
+// from the index of archiveDir. Repos already in the index are replaced.
+func updateArchiveIndex(archiveDir string, added []ArchiveMetadata, removed []string) error {
+	repos, err := readArchiveIndex(archiveDir)
+	if err != nil {
+		return err
+	}
+
+	drop := map[string]bool{}
+	for _, name := range removed {
+		drop[name] = true
+	}
+
+	for _, metadata := range added {
+		drop[metadata.Name] = true
+	}
+
+	index := archiveIndex{Repos: added}
+
+	for _, metadata := range repos {
+		if !drop[metadata.Name] {
+			index.Repos = append(index.Repos, metadata)
+		}
+	}
+
+	sort.Slice(index.Repos, func(i, j int) bool {
+		return index.Repos[i].Name < index.Repos[j].Name
+	})
+
+	b, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(archiveDir, archiveIndexFile), b, 0644)
+}
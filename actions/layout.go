@@ -0,0 +1,108 @@
+package actions
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Layout decides where in the download dir each repo is cloned
+type Layout string
+
+const (
+	// LayoutFlat clones every repo into a dir named after it
+	LayoutFlat Layout = "flat"
+	// LayoutOwner clones repos into a dir per owner so repos with the same
+	// name in different orgs don't collide
+	LayoutOwner Layout = "owner/name"
+	// LayoutHost also adds a dir per git host
+	LayoutHost Layout = "host/owner/name"
+)
+
+// mirrorSuffix is added to the dir of mirror clones as is usual for bare repos
+const mirrorSuffix = ".git"
+
+// maxLayoutDepth limits how deep repos are looked for with layouts other than
+// flat, which can be deeper than owner/name for nested gitlab groups
+const maxLayoutDepth = 10
+
+var layouts = []Layout{LayoutFlat, LayoutOwner, LayoutHost}
+
+// ParseLayout returns the Layout named s
+func ParseLayout(s string) (Layout, error) {
+	for _, layout := range layouts {
+		if Layout(s) == layout {
+			return layout, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown layout [%s], must be one of %v", s, layouts)
+}
+
+// Path returns the path of repo relative to the download dir
+func (l Layout) Path(repo *Repo) string {
+	name := repo.Name
+	if viper.GetBool("mirror") {
+		name += mirrorSuffix
+	}
+
+	switch l {
+	case LayoutOwner:
+		return path.Join(repo.Owner, name)
+	case LayoutHost:
+		return path.Join(repo.Host, repo.Owner, name)
+	}
+
+	return name
+}
+
+// BaseName returns the name upstream of the repo at path p in the layout
+func BaseName(p string) string {
+	name := path.Base(p)
+	if viper.GetBool("mirror") {
+		name = strings.TrimSuffix(name, mirrorSuffix)
+	}
+
+	return name
+}
+
+// Namespace returns the owner, including any subgroups, of the repo at path p
+// in the layout, or "" if the layout doesn't have one
+func (l Layout) Namespace(p string) string {
+	switch l {
+	case LayoutOwner:
+	case LayoutHost:
+		i := strings.Index(p, "/")
+		if i < 0 {
+			return ""
+		}
+
+		p = p[i+1:]
+	default:
+		return ""
+	}
+
+	if namespace := path.Dir(p); namespace != "." {
+		return namespace
+	}
+
+	return ""
+}
+
+// maxDepth is how many dirs deep repos can be found in the download dir
+func (l Layout) maxDepth() int {
+	if l == LayoutFlat || l == "" {
+		return 1
+	}
+
+	return maxLayoutDepth
+}
+
+// ApplyLayout sets the name of every repo to its path in layout
+func (repos Repos) ApplyLayout(layout Layout) {
+	for _, repo := range repos {
+		repo.Name = layout.Path(repo)
+	}
+}
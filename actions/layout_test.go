@@ -0,0 +1,138 @@
+package actions
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayoutPath(t *testing.T) {
+	repo := &Repo{Name: "docs", Owner: "foo", Host: "github.com"}
+
+	assert.Equal(t, "docs", LayoutFlat.Path(repo))
+	assert.Equal(t, "foo/docs", LayoutOwner.Path(repo))
+	assert.Equal(t, "github.com/foo/docs", LayoutHost.Path(repo))
+
+	assert.Equal(t, "", LayoutFlat.Namespace("docs"))
+	assert.Equal(t, "foo", LayoutOwner.Namespace("foo/docs"))
+	assert.Equal(t, "group/sub", LayoutOwner.Namespace("group/sub/docs"))
+	assert.Equal(t, "", LayoutOwner.Namespace("docs"))
+	assert.Equal(t, "group/sub", LayoutHost.Namespace("gitlab.com/group/sub/docs"))
+	assert.Equal(t, "", LayoutHost.Namespace("gitlab.com/docs"))
+
+	_, err := ParseLayout("nested")
+	assert.EqualError(t, err, "unknown layout [nested], must be one of [flat owner/name host/owner/name]")
+}
+
+func TestGetDirListLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, repo := range []string{"flat", "foo/docs", "bar/docs", "group/sub/infra", ".archive/foo/old"} {
+		assert.NoError(t, os.MkdirAll(dir+"/"+repo, 0755))
+		runGit(t, dir+"/"+repo, "init", "-q")
+	}
+
+	// Repos inside repos are not looked for
+	assert.NoError(t, os.MkdirAll(dir+"/flat/nested", 0755))
+	runGit(t, dir+"/flat/nested", "init", "-q")
+
+	dirs, err := GetGitDirList(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"flat"}, dirs)
+
+	viper.Set("layout", "owner/name")
+	defer viper.Set("layout", "flat")
+
+	dirs, err = GetGitDirList(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bar/docs", "flat", "foo/docs", "group/sub/infra"}, dirs)
+}
+
+func TestMoveRepos(t *testing.T) {
+	testDir := CreateTestDirs()
+	defer os.RemoveAll(testDir)
+
+	assert.NoError(t, os.MkdirAll(testDir+"/bar/existing", 0755))
+
+	repos := Repos{
+		{Name: "foo/renamed", OldName: "gitDir", SSHURL: "git@github.com:foo/renamed.git", ID: "github.com/1"},
+		{Name: "bar/existing", OldName: "notGitDir"},
+	}
+	repos.MoveRepos(context.Background(), testDir)
+
+	assert.Equal(t, Info, repos[0].Severity)
+	assert.DirExists(t, testDir+"/foo/renamed")
+	assert.NoDirExists(t, testDir+"/gitDir")
+
+	url, err := RemoteURL(context.Background(), testDir+"/foo/renamed")
+	assert.NoError(t, err)
+	assert.Equal(t, "git@github.com:foo/renamed.git", url)
+	assert.Equal(t, "github.com/1", RepoID(context.Background(), testDir+"/foo/renamed"))
+
+	assert.Equal(t, Error, repos[1].Severity)
+	assert.Equal(t, "not moving from notGitDir as "+testDir+"/bar/existing already exists", repos[1].Message)
+	assert.DirExists(t, testDir+"/notGitDir")
+}
+
+func TestSetRemotes(t *testing.T) {
+	testDir := CreateTestDirs()
+	defer os.RemoveAll(testDir)
+
+	repos := Repos{
+		{Name: "gitDir", URL: "git@github-work:foo/gitDir.git"},
+		{Name: "notGitDir", URL: "git@github-work:foo/notGitDir.git"},
+	}
+	runGit(t, testDir+"/gitDir", "remote", "add", "origin", "git@github.com:foo/gitDir.git")
+	repos.SetRemotes(context.Background(), testDir)
+
+	assert.Equal(t, Info, repos[0].Severity)
+	url, err := RemoteURL(context.Background(), testDir+"/gitDir")
+	assert.NoError(t, err)
+	assert.Equal(t, "git@github-work:foo/gitDir.git", url)
+
+	assert.Equal(t, Error, repos[1].Severity)
+}
+
+func TestSameURL(t *testing.T) {
+	assert.True(t, SameURL("git@github.com:Foo/bar.git", "git@github.com:foo/bar"))
+	assert.False(t, SameURL("git@github.com:foo/bar.git", "git@github.com:baz/bar.git"))
+}
+
+func TestFindGitDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, repo := range []string{"top", "work/api", "oss/tools/cli", "scratch/tmp", "archive/old", "top/nested"} {
+		assert.NoError(t, os.MkdirAll(dir+"/"+repo, 0755))
+		runGit(t, dir+"/"+repo, "init", "-q")
+	}
+
+	runGit(t, dir, "init", "-q", "--bare", "oss/mirror.git")
+
+	commit(t, dir+"/work/api", "first")
+	runGit(t, dir+"/work/api", "worktree", "add", "-q", dir+"/work/api-feature")
+
+	viper.Set("ignore", []string{"scratch"})
+	defer viper.Set("ignore", nil)
+
+	viper.Set("archive-dir", dir+"/archive/")
+	defer viper.Set("archive-dir", "")
+
+	findGitDirs := func(maxDepth int) []string {
+		dirs, err := FindGitDirs(dir, maxDepth)
+		assert.NoError(t, err)
+
+		return dirs
+	}
+
+	assert.Equal(t, []string{"oss/mirror.git", "top", "work/api", "work/api-feature"}, findGitDirs(2))
+	assert.Equal(t, []string{"oss/mirror.git", "oss/tools/cli", "top", "work/api", "work/api-feature"}, findGitDirs(3))
+	assert.Equal(t, []string{"top"}, findGitDirs(1))
+}
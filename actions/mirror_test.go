@@ -0,0 +1,59 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirror(t *testing.T) {
+	testDir, _ := createSyncTestRepos(t)
+	defer os.RemoveAll(testDir)
+
+	viper.Set("mirror", true)
+	defer viper.Set("mirror", false)
+
+	repo := &Repo{Name: "mirror", Owner: "foo", SSHURL: testDir + "/remote.git"}
+	assert.Equal(t, "mirror.git", LayoutFlat.Path(repo))
+	assert.Equal(t, "foo/mirror.git", LayoutOwner.Path(repo))
+	assert.Equal(t, "mirror", BaseName("foo/mirror.git"))
+
+	Repos{repo}.ApplyLayout(LayoutFlat)
+	repos := Repos{repo}
+	repos.CloneRepos(context.Background(), testDir)
+	assert.Equal(t, Info, repo.Severity, repo.Message)
+
+	bare, err := gitOutput(context.Background(), testDir+"/mirror.git", "rev-parse", "--is-bare-repository")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"true"}, bare)
+	dirs, err := GetGitDirList(testDir)
+	assert.NoError(t, err)
+	assert.Contains(t, dirs, "mirror.git")
+
+	upstream := testDir + "/upstream"
+	commit(t, upstream, "third")
+	runGit(t, upstream, "push", "-q", "origin", "main")
+	runGit(t, upstream, "push", "-q", "origin", "--delete", "feature")
+
+	repos.SyncRepos(context.Background(), testDir)
+	assert.Equal(t, Info, repo.Severity, repo.Message)
+	assert.Empty(t, repo.Branches)
+
+	want, err := gitOutput(context.Background(), upstream, "rev-parse", "HEAD")
+	assert.NoError(t, err)
+	got, err := gitOutput(context.Background(), testDir+"/mirror.git", "rev-parse", "main")
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	branches, err := gitOutput(context.Background(), testDir+"/mirror.git", "branch", "--format=%(refname:short)")
+	assert.NoError(t, err)
+	assert.NotContains(t, branches, "feature")
+
+	// Mirrors are archived without checking for unsaved work
+	repos.ArchiveRepos(context.Background(), testDir, testDir+"/.archive")
+	assert.Equal(t, Info, repo.Severity, repo.Message)
+	assert.DirExists(t, testDir+"/.archive/mirror.git")
+}
@@ -1,5 +1,7 @@
 package actions
 
+import "time"
+
 type Severity int
 
 const (
@@ -8,12 +10,66 @@ const (
 	Error
 )
 
+type BranchStatus int
+
+const (
+	BranchUpToDate BranchStatus = iota
+	BranchUpdated
+	BranchRebased
+	BranchReset
+	BranchBehind
+	BranchAhead
+	BranchDiverged
+	BranchUpstreamGone
+	BranchUncommitted
+	BranchFailed
+)
+
+// BranchResult is the outcome of syncing a single local branch with its upstream
+type BranchResult struct {
+	Name     string       `json:"name"`
+	Upstream string       `json:"upstream"`
+	Status   BranchStatus `json:"status"`
+	Message  string       `json:"message,omitempty"`
+}
+
+// ArchiveReason is why a repo is archived
+type ArchiveReason string
+
+const (
+	// ReasonArchived is for repos that were archived upstream
+	ReasonArchived ArchiveReason = "archived upstream"
+	// ReasonDeleted is for local repos that no longer exist upstream
+	ReasonDeleted ArchiveReason = "deleted upstream"
+)
+
 type Repo struct {
-	Name     string `json:"name"`
-	SSHURL   string `json:"ssh_url"`
-	Message  string
-	Severity Severity
-	Archived bool `json:"archived"`
+	// Name is the path of the repo relative to the download dir, which is
+	// just its name with the flat layout
+	Name   string `json:"name"`
+	SSHURL string `json:"ssh_url"`
+	// HTTPSURL is used instead of SSHURL with --protocol https
+	HTTPSURL string `json:"https_url,omitempty"`
+	// URL is used instead of both when set by --clone-url-template
+	URL string `json:"url,omitempty"`
+	// ID identifies the repo upstream even after it is renamed or transferred
+	ID string `json:"id,omitempty"`
+	// Owner is the org, user or group the repo belongs to upstream
+	Owner string `json:"owner,omitempty"`
+	// Host is the git host the repo is cloned from e.g. github.com
+	Host string `json:"host,omitempty"`
+	// OldName is where the repo is moved from before anything else is done
+	OldName  string   `json:"old_name,omitempty"`
+	Message  string   `json:"message,omitempty"`
+	Severity Severity `json:"-"`
+	Archived bool     `json:"archived"`
+	// Reason is set on repos to archive
+	Reason   ArchiveReason  `json:"archive_reason,omitempty"`
+	Branches []BranchResult `json:"-"`
+	// Attempts is how many times the clone or fetch was tried
+	Attempts int `json:"-"`
+	// Duration is the total time spent running actions on the repo
+	Duration time.Duration `json:"-"`
 }
 
 type Repos []*Repo
@@ -21,3 +77,36 @@ type Repos []*Repo
 func (s Severity) String() string {
 	return [...]string{"Info", "Warning", "Error"}[s]
 }
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s BranchStatus) String() string {
+	return [...]string{
+		"up to date",
+		"updated",
+		"rebased",
+		"reset to upstream",
+		"behind upstream",
+		"ahead of upstream",
+		"diverged from upstream",
+		"upstream deleted",
+		"has uncommitted changes",
+		"failed",
+	}[s]
+}
+
+// Severity is how much attention a branch in this status needs
+func (s BranchStatus) Severity() Severity {
+	switch s {
+	case BranchDiverged, BranchUpstreamGone, BranchUncommitted, BranchFailed:
+		return Warning
+	}
+
+	return Info
+}
+
+func (s BranchStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
@@ -0,0 +1,150 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lhopki01/git-mass-sync/debug"
+	"github.com/mitchellh/colorstring"
+	"github.com/spf13/viper"
+)
+
+// idConfigKey is the git config key the ID of a repo is stored under
+const idConfigKey = "gms.id"
+
+// MoveRepos moves every repo from its OldName to its Name in dir and points
+// its origin at the repo's url if it doesn't already
+func (repos Repos) MoveRepos(ctx context.Context, dir string) {
+	for _, repo := range repos {
+		if viper.GetBool("dry-run") {
+			colorstring.Fprintf(out, "[blue]Would move %s to %s\n", repo.OldName, repo.Name)
+			continue
+		}
+
+		if ctx.Err() != nil {
+			repo.fail(cancelledMessage)
+			continue
+		}
+
+		colorstring.Fprintf(out, "[blue]Moving %s to %s\n", repo.OldName, repo.Name)
+		repo.move(ctx, dir)
+	}
+}
+
+func (repo *Repo) move(ctx context.Context, dir string) {
+	defer repo.addDuration(time.Now())
+
+	to := filepath.Join(dir, repo.Name)
+
+	err := moveDir(filepath.Join(dir, repo.OldName), to)
+	if err != nil {
+		repo.fail(fmt.Sprintf("not moving from %s as %s", repo.OldName, err))
+		return
+	}
+
+	if repo.SSHURL != "" {
+		url, err := RemoteURL(ctx, to)
+
+		switch {
+		case err != nil:
+			err = gitRun(ctx, to, "remote", "add", "origin", repo.CloneURL())
+		case !repo.HasURL(url):
+			err = gitRun(ctx, to, "remote", "set-url", "origin", repo.CloneURL())
+		}
+
+		if err != nil {
+			repo.fail(fmt.Sprintf("moved from %s but unable to update origin: %s", repo.OldName, err))
+			return
+		}
+	}
+
+	repo.storeID(ctx, to)
+}
+
+// SetRemotes points the origin of every repo in dir at its clone url
+func (repos Repos) SetRemotes(ctx context.Context, dir string) {
+	for _, repo := range repos {
+		if viper.GetBool("dry-run") {
+			colorstring.Fprintf(out, "[blue]Would set origin of %s to %s\n", repo.Name, repo.CloneURL())
+			continue
+		}
+
+		if ctx.Err() != nil {
+			repo.fail(cancelledMessage)
+			continue
+		}
+
+		colorstring.Fprintf(out, "[blue]Setting origin of %s to %s\n", repo.Name, repo.CloneURL())
+
+		err := gitRun(ctx, filepath.Join(dir, repo.Name), "remote", "set-url", "origin", repo.CloneURL())
+		if err != nil {
+			repo.fail(fmt.Sprintf("unable to set origin: %s", err))
+		}
+	}
+}
+
+// moveDir moves from to to, creating the parent dirs of to but never
+// replacing it
+func moveDir(from, to string) error {
+	if _, err := os.Stat(to); err == nil {
+		return fmt.Errorf("%s already exists", to)
+	}
+
+	err := os.MkdirAll(filepath.Dir(to), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(from, to)
+}
+
+// storeID records the ID of the repo in its git config so it can still be
+// recognised after being renamed upstream
+func (repo *Repo) storeID(ctx context.Context, dir string) {
+	if repo.ID == "" {
+		return
+	}
+
+	err := gitRun(ctx, dir, "config", idConfigKey, repo.ID)
+	if err != nil {
+		debug.Debugf("[%s] unable to store id: %s", repo.Name, err)
+	}
+}
+
+// RepoID returns the ID stored in the git config of the repo at dir, if any
+func RepoID(ctx context.Context, dir string) string {
+	id, err := gitOutput(ctx, dir, "config", "--get", idConfigKey)
+	if err != nil || len(id) != 1 {
+		return ""
+	}
+
+	return id[0]
+}
+
+// RemoteURL returns the url of the origin remote of the repo at dir
+func RemoteURL(ctx context.Context, dir string) (string, error) {
+	url, err := gitOutput(ctx, dir, "remote", "get-url", "origin")
+	if err != nil {
+		return "", err
+	}
+
+	if len(url) != 1 {
+		return "", fmt.Errorf("origin remote has no url")
+	}
+
+	return url[0], nil
+}
+
+// SameURL reports whether two clone urls point at the same repo, ignoring
+// case and a trailing .git
+func SameURL(a, b string) bool {
+	trim := func(url string) string {
+		return strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(url), "/"), ".git")
+	}
+
+	return trim(a) == trim(b)
+}
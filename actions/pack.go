@@ -0,0 +1,328 @@
+package actions
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ArchiveFormat decides how repos are stored in the archive dir
+type ArchiveFormat string
+
+const (
+	// ArchiveFormatDir moves the repo into the archive dir as it is
+	ArchiveFormatDir ArchiveFormat = "dir"
+	// ArchiveFormatTarGz packs the whole repo dir into a .tar.gz
+	ArchiveFormatTarGz ArchiveFormat = "tar.gz"
+	// ArchiveFormatBundle keeps only the commits of the repo in a git bundle
+	ArchiveFormatBundle ArchiveFormat = "bundle"
+)
+
+// metadataExt is added to the name of a packed archive for its metadata
+const metadataExt = ".json"
+
+var archiveFormats = []ArchiveFormat{ArchiveFormatDir, ArchiveFormatTarGz, ArchiveFormatBundle}
+
+// ParseArchiveFormat returns the ArchiveFormat named s, which defaults to dir
+func ParseArchiveFormat(s string) (ArchiveFormat, error) {
+	if s == "" {
+		return ArchiveFormatDir, nil
+	}
+
+	for _, format := range archiveFormats {
+		if ArchiveFormat(s) == format {
+			return format, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown archive format [%s], must be one of %v", s, archiveFormats)
+}
+
+// path returns where a repo archived at archivePath is stored in this format
+func (f ArchiveFormat) path(archivePath string) string {
+	if f == ArchiveFormatDir || f == "" {
+		return archivePath
+	}
+
+	return archivePath + "." + string(f)
+}
+
+// ArchiveMetadata is written next to a packed archive to record where it came
+// from and why it was archived
+type ArchiveMetadata struct {
+	Name       string        `json:"name"`
+	SSHURL     string        `json:"ssh_url,omitempty"`
+	ID         string        `json:"id,omitempty"`
+	Reason     ArchiveReason `json:"reason"`
+	ArchivedAt time.Time     `json:"archived_at"`
+	Head       string        `json:"head,omitempty"`
+	Format     ArchiveFormat `json:"format"`
+}
+
+// PackedArchive is a packed repo found in the archive dir
+type PackedArchive struct {
+	// Path is the path of the packed file relative to the archive dir
+	Path     string
+	Metadata ArchiveMetadata
+}
+
+// InArchive reports whether the repo name is in archiveDir in any format
+func InArchive(archiveDir, name string) bool {
+	for _, format := range archiveFormats {
+		if _, err := os.Stat(format.path(filepath.Join(archiveDir, name))); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// archiveReason returns why the repo is being archived, working it out for
+// repos from plans made before reasons were recorded
+func (repo *Repo) archiveReason() ArchiveReason {
+	switch {
+	case repo.Reason != "":
+		return repo.Reason
+	case repo.Archived:
+		return ReasonArchived
+	}
+
+	return ReasonDeleted
+}
+
+// archiveMetadata describes the repo at repoDir as it is archived
+func (repo *Repo) archiveMetadata(ctx context.Context, repoDir string) ArchiveMetadata {
+	format, _ := ParseArchiveFormat(viper.GetString("archive-format"))
+
+	metadata := ArchiveMetadata{
+		Name:       repo.Name,
+		SSHURL:     repo.SSHURL,
+		ID:         repo.ID,
+		Reason:     repo.archiveReason(),
+		ArchivedAt: time.Now().UTC(),
+		Format:     format,
+	}
+
+	if head, err := gitOutput(ctx, repoDir, "rev-parse", "HEAD"); err == nil && len(head) == 1 {
+		metadata.Head = head[0]
+	}
+
+	return metadata
+}
+
+// pack packs the repo at repoDir into archivePath in the format of metadata,
+// writes the metadata alongside and then removes repoDir
+func (repo *Repo) pack(ctx context.Context, repoDir, archivePath string, metadata ArchiveMetadata) error {
+	format := metadata.Format
+	packed := format.path(archivePath)
+
+	if _, err := os.Stat(packed); err == nil {
+		return fmt.Errorf("%s already exists", packed)
+	}
+
+	// Write to a temporary file so a failed or cancelled pack never leaves a
+	// partial archive behind
+	tmp := packed + ".tmp"
+	defer os.Remove(tmp)
+
+	var err error
+
+	switch format {
+	case ArchiveFormatTarGz:
+		err = writeTarGz(ctx, repoDir, filepath.Base(archivePath), tmp)
+	case ArchiveFormatBundle:
+		abs, absErr := filepath.Abs(tmp)
+		if absErr != nil {
+			return absErr
+		}
+
+		err = gitRun(ctx, repoDir, "bundle", "create", abs, "--all")
+	default:
+		return fmt.Errorf("unable to pack in format %s", format)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(packed+metadataExt, b, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp, packed)
+	if err != nil {
+		os.Remove(packed + metadataExt)
+		return err
+	}
+
+	return os.RemoveAll(repoDir)
+}
+
+// writeTarGz writes the contents of dir to a gzipped tar at file with every
+// path prefixed by prefix. It stops if ctx ends.
+func writeTarGz(ctx context.Context, dir, prefix, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		header.Name = filepath.ToSlash(filepath.Join(prefix, rel))
+
+		err = tw.WriteHeader(header)
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		_, err = io.Copy(tw, contextReader{ctx: ctx, r: src})
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// contextReader stops reading once ctx ends so packing large files can be
+// cancelled part way through
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(p)
+}
+
+// PackedArchives returns every packed repo in archiveDir that has metadata
+func PackedArchives(archiveDir string) ([]*PackedArchive, error) {
+	var archives []*PackedArchive
+
+	err := filepath.Walk(archiveDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Repos archived as dirs have no metadata so aren't looked in
+		if info.IsDir() && path != archiveDir && IsGitDir(path) {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() || !strings.HasSuffix(path, metadataExt) {
+			return nil
+		}
+
+		packed := strings.TrimSuffix(path, metadataExt)
+		if _, err := os.Stat(packed); err != nil {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		archive := &PackedArchive{}
+
+		err = json.Unmarshal(b, &archive.Metadata)
+		if err != nil {
+			return fmt.Errorf("unable to parse %s: %s", path, err)
+		}
+
+		archive.Path, err = filepath.Rel(archiveDir, packed)
+		if err != nil {
+			return err
+		}
+
+		archives = append(archives, archive)
+
+		return nil
+	})
+
+	return archives, err
+}
+
+// RemovePacked deletes a packed archive and its metadata from archiveDir
+func RemovePacked(archiveDir string, archive *PackedArchive) error {
+	path := filepath.Join(archiveDir, archive.Path)
+
+	err := os.Remove(path)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path + metadataExt)
+	if err != nil {
+		return err
+	}
+
+	return updateArchiveIndex(archiveDir, nil, []string{archive.Metadata.Name})
+}
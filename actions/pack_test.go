@@ -0,0 +1,102 @@
+package actions
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveReposPacked(t *testing.T) {
+	for _, format := range []ArchiveFormat{ArchiveFormatTarGz, ArchiveFormatBundle} {
+		t.Run(string(format), func(t *testing.T) {
+			dir, _ := createSyncTestRepos(t)
+			defer os.RemoveAll(dir)
+
+			viper.Set("archive-format", string(format))
+			defer viper.Set("archive-format", "")
+
+			archiveDir := dir + "/.archive"
+			repos := Repos{{Name: "upstream", ID: "github.com/1", Archived: true}}
+			repos.ArchiveRepos(context.Background(), dir, archiveDir)
+
+			assert.Equal(t, Info, repos[0].Severity, repos[0].Message)
+			assert.NoDirExists(t, dir+"/upstream")
+			assert.FileExists(t, archiveDir+"/upstream."+string(format))
+			assert.True(t, InArchive(archiveDir, "upstream"))
+
+			archives, err := PackedArchives(archiveDir)
+			assert.NoError(t, err)
+			assert.Len(t, archives, 1)
+			assert.Equal(t, "upstream."+string(format), archives[0].Path)
+			assert.Equal(t, "upstream", archives[0].Metadata.Name)
+			assert.Equal(t, "github.com/1", archives[0].Metadata.ID)
+			assert.Equal(t, ReasonArchived, archives[0].Metadata.Reason)
+			assert.Equal(t, format, archives[0].Metadata.Format)
+			assert.Len(t, archives[0].Metadata.Head, 40)
+
+			// The archive can be restored from
+			if format == ArchiveFormatTarGz {
+				cmd := exec.Command("tar", "-xzf", archiveDir+"/upstream.tar.gz")
+				cmd.Dir = dir
+				assert.NoError(t, cmd.Run())
+			} else {
+				cmd := exec.Command("git", "clone", "-q", archiveDir+"/upstream.bundle", "upstream")
+				cmd.Dir = dir
+				assert.NoError(t, cmd.Run())
+			}
+			head, err := gitOutput(context.Background(), dir+"/upstream", "rev-parse", "HEAD")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{archives[0].Metadata.Head}, head)
+
+			// A repo already packed isn't replaced
+			repos = Repos{{Name: "upstream"}}
+			repos.ArchiveRepos(context.Background(), dir, archiveDir)
+			assert.Equal(t, Error, repos[0].Severity)
+			assert.Equal(t, archiveDir+"/upstream."+string(format)+" already exists", repos[0].Message)
+			assert.DirExists(t, dir+"/upstream")
+
+			index, err := readArchiveIndex(archiveDir)
+			assert.NoError(t, err)
+			assert.Equal(t, []ArchiveMetadata{archives[0].Metadata}, index)
+
+			assert.NoError(t, RemovePacked(archiveDir, archives[0]))
+			assert.False(t, InArchive(archiveDir, "upstream"))
+
+			index, err = readArchiveIndex(archiveDir)
+			assert.NoError(t, err)
+			assert.Empty(t, index)
+			assert.NoFileExists(t, archiveDir+"/upstream."+string(format)+".json")
+		})
+	}
+}
+
+func TestPackCancelled(t *testing.T) {
+	dir, _ := createSyncTestRepos(t)
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	repo := &Repo{Name: "upstream"}
+	archivePath := dir + "/.archive/upstream"
+	assert.NoError(t, os.MkdirAll(dir+"/.archive", 0755))
+
+	err := repo.pack(ctx, dir+"/upstream", archivePath, ArchiveMetadata{Name: "upstream", Format: ArchiveFormatTarGz})
+	assert.Equal(t, context.Canceled, err)
+	assert.DirExists(t, dir+"/upstream")
+	assert.False(t, InArchive(dir+"/.archive", "upstream"))
+	assert.NoFileExists(t, archivePath+".tar.gz.tmp")
+}
+
+func TestParseArchiveFormat(t *testing.T) {
+	format, err := ParseArchiveFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, ArchiveFormatDir, format)
+
+	_, err = ParseArchiveFormat("zip")
+	assert.EqualError(t, err, "unknown archive format [zip], must be one of [dir tar.gz bundle]")
+}
@@ -0,0 +1,101 @@
+package actions
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/lhopki01/git-mass-sync/debug"
+	"github.com/spf13/viper"
+)
+
+const retryMaxDelay = 30 * time.Second
+
+// retryBaseDelay is the delay before the first retry, a var so tests can shorten it
+var retryBaseDelay = time.Second
+
+// transientErrors are fragments of git output that mean a command failed
+// because of the network or the server rather than anything that will still
+// be wrong if it is run again.
+var transientErrors = []string{
+	"the remote end hung up unexpectedly",
+	"early eof",
+	"unexpected disconnect",
+	"connection reset",
+	"connection timed out",
+	"connection refused",
+	"connection closed by",
+	"operation timed out",
+	"could not resolve host",
+	"temporary failure in name resolution",
+	"kex_exchange_identification",
+	"ssh_exchange_identification",
+	"rpc failed",
+	"gnutls_handshake() failed",
+	"the requested url returned error: 500",
+	"the requested url returned error: 502",
+	"the requested url returned error: 503",
+	"the requested url returned error: 504",
+	"internal server error",
+	"bad gateway",
+	"service unavailable",
+}
+
+// isTransient reports whether git output describes a failure worth retrying
+func isTransient(output string) bool {
+	output = strings.ToLower(output)
+
+	for _, e := range transientErrors {
+		if strings.Contains(output, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff returns how long to wait before the given retry, starting at 1.
+// The delay doubles each time and up to half of it is random jitter so
+// parallel clones that failed together don't all retry at once.
+func backoff(retry int) time.Duration {
+	delay := retryBaseDelay << uint(retry-1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+
+	half := delay / 2 //nolint:gomnd
+
+	//nolint:gosec
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+// withRetries runs op up to --retries more times while it fails with a
+// transient error, returning the output and error of the last attempt and how
+// many attempts were made. cleanup is run before each retry.
+func withRetries(ctx context.Context, name string, op func() (string, error), cleanup func()) (string, int, error) {
+	retries := viper.GetInt("retries")
+	attempt := 1
+
+	for {
+		output, err := op()
+		if err == nil || attempt > retries || ctx.Err() != nil || !isTransient(output) {
+			return output, attempt, err
+		}
+
+		delay := backoff(attempt)
+		debug.Debugf("[%s] failed with a transient error, retrying in %s: %s", name, delay, output)
+
+		select {
+		case <-ctx.Done():
+			return output, attempt, err
+		case <-time.After(delay):
+		}
+
+		if cleanup != nil {
+			cleanup()
+		}
+
+		attempt++
+	}
+}
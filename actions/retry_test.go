@@ -0,0 +1,91 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, isTransient("fatal: the remote end hung up unexpectedly\n"))
+	assert.True(t, isTransient("error: RPC failed; HTTP 502 curl 22 The requested URL returned error: 502\n"))
+	assert.True(t, isTransient("ssh: Could not resolve host: github.com\n"))
+	assert.False(t, isTransient("ERROR: Repository not found.\nfatal: Could not read from remote repository.\n"))
+	assert.False(t, isTransient("git@github.com: Permission denied (publickey).\n"))
+}
+
+func TestBackoff(t *testing.T) {
+	for retry := 1; retry < 10; retry++ {
+		delay := backoff(retry)
+		expected := retryBaseDelay << uint(retry-1)
+		if expected > retryMaxDelay {
+			expected = retryMaxDelay
+		}
+		assert.True(t, delay >= expected/2 && delay < expected, "retry %d delay %s", retry, delay)
+	}
+}
+
+func TestWithRetries(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	viper.Set("retries", 2)
+	defer viper.Set("retries", 0)
+
+	type testCase struct {
+		tName            string
+		outputs          []string
+		expectedAttempts int
+		expectedErr      bool
+	}
+	testCases := []testCase{
+		{
+			tName:            "succeeds first time",
+			outputs:          []string{""},
+			expectedAttempts: 1,
+		},
+		{
+			tName:            "succeeds after transient failures",
+			outputs:          []string{"fatal: early EOF", "fatal: early EOF", ""},
+			expectedAttempts: 3,
+		},
+		{
+			tName:            "runs out of retries",
+			outputs:          []string{"fatal: early EOF", "fatal: early EOF", "fatal: early EOF", ""},
+			expectedAttempts: 3,
+			expectedErr:      true,
+		},
+		{
+			tName:            "permanent failure",
+			outputs:          []string{"fatal: repository does not exist", ""},
+			expectedAttempts: 1,
+			expectedErr:      true,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			calls, cleanups := 0, 0
+			_, attempts, err := withRetries(
+				context.Background(),
+				"repo",
+				func() (string, error) {
+					output := tc.outputs[calls]
+					calls++
+					if output != "" {
+						return output, errors.New("exit status 128")
+					}
+					return output, nil
+				},
+				func() { cleanups++ },
+			)
+			assert.Equal(t, tc.expectedAttempts, attempts)
+			assert.Equal(t, tc.expectedAttempts-1, cleanups)
+			assert.Equal(t, tc.expectedErr, err != nil)
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Strategy decides what syncing does to local branches once remotes are fetched
+type Strategy string
+
+const (
+	// StrategyFetch never touches local branches or the working tree
+	StrategyFetch Strategy = "fetch"
+	// StrategyFFOnly fast-forwards branches that are behind their upstream
+	StrategyFFOnly Strategy = "ff-only"
+	// StrategyRebase also rebases diverged branches onto their upstream
+	StrategyRebase Strategy = "rebase"
+	// StrategyReset hard resets every branch to its upstream, discarding local work
+	StrategyReset Strategy = "reset"
+)
+
+var strategies = []Strategy{StrategyFetch, StrategyFFOnly, StrategyRebase, StrategyReset}
+
+// ParseStrategy returns the Strategy named s
+func ParseStrategy(s string) (Strategy, error) {
+	for _, strategy := range strategies {
+		if Strategy(s) == strategy {
+			return strategy, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown sync strategy [%s], must be one of %v", s, strategies)
+}
+
+// branchRef is a local branch that tracks a remote branch
+type branchRef struct {
+	name        string
+	sha         string
+	upstreamRef string
+	upstream    string
+	// track is the upstream tracking state e.g. "ahead 1, behind 2" or "gone"
+	track string
+}
+
+// sync fetches all remotes of the repo at dir and then updates every local
+// branch that tracks a remote branch according to strategy. The checked out
+// branch is only updated if the working tree is clean, unless resetting. The
+// outcome for each branch is recorded in repo.Branches. Mirrors are only
+// fetched.
+func (repo *Repo) sync(ctx context.Context, dir string, strategy Strategy) {
+	remotes, err := gitOutput(ctx, dir, "remote")
+	if err != nil {
+		repo.fail(err.Error())
+		return
+	}
+
+	if len(remotes) == 0 {
+		repo.fail("no git remotes found\n")
+		return
+	}
+
+	fetch := []string{"fetch", "--all", "--prune", "--quiet"}
+
+	// Mirrors have no local branches, their refs are kept exactly in step
+	// with their remotes
+	mirror := viper.GetBool("mirror")
+	if mirror {
+		fetch = []string{"remote", "update", "--prune"}
+	}
+
+	output, attempts, err := withRetries(
+		ctx,
+		repo.Name,
+		func() (string, error) {
+			output, err := gitCommand(ctx, dir, append(repo.urlRewrites(), fetch...)...).CombinedOutput()
+			return string(output), err
+		},
+		nil,
+	)
+	repo.Attempts = attempts
+
+	if err != nil {
+		repo.fail(output)
+		return
+	}
+
+	if mirror {
+		return
+	}
+
+	// Fails when HEAD is detached, in which case no branch is checked out
+	current, _ := gitOutput(ctx, dir, "symbolic-ref", "--quiet", "--short", "HEAD")
+
+	// What to check out again after rebasing a branch that isn't checked out
+	head, _ := gitOutput(ctx, dir, "rev-parse", "HEAD")
+	if len(current) == 1 {
+		head = current
+	}
+
+	restore := ""
+	if len(head) == 1 {
+		restore = head[0]
+	}
+
+	// Bare repos have no working tree so branches can only be moved with
+	// update-ref and never rebased
+	bare, _ := gitOutput(ctx, dir, "rev-parse", "--is-bare-repository")
+	if len(bare) == 1 && bare[0] == "true" {
+		current = nil
+		restore = ""
+	}
+
+	refs, err := gitOutput(
+		ctx,
+		dir,
+		"for-each-ref",
+		"--format=%(refname:short)\t%(objectname)\t%(upstream)\t%(upstream:short)\t%(upstream:track,nobracket)",
+		"refs/heads",
+	)
+	if err != nil {
+		repo.fail(err.Error())
+		return
+	}
+
+	repo.Branches = nil
+
+	var messages []string
+
+	for _, line := range refs {
+		//nolint:gomnd
+		fields := strings.SplitN(line, "\t", 5)
+		//nolint:gomnd
+		if len(fields) != 5 || fields[2] == "" {
+			// Not tracking a remote branch
+			continue
+		}
+
+		ref := branchRef{
+			name:        fields[0],
+			sha:         fields[1],
+			upstreamRef: fields[2],
+			upstream:    fields[3],
+			track:       fields[4],
+		}
+
+		checkedOut := len(current) == 1 && current[0] == ref.name
+
+		branch := syncBranch(ctx, dir, ref, strategy, checkedOut, restore)
+		repo.Branches = append(repo.Branches, branch)
+
+		if branch.Status.Severity() > repo.Severity {
+			repo.Severity = branch.Status.Severity()
+		}
+
+		if branch.Status != BranchUpToDate {
+			messages = append(messages, branch.String())
+		}
+	}
+
+	repo.Message = strings.Join(messages, "\n")
+}
+
+// syncBranch brings a single branch up to date with its upstream using
+// strategy. restore is checked out again if a different branch has to be
+// checked out to rebase it.
+func syncBranch(ctx context.Context, dir string, ref branchRef, strategy Strategy, checkedOut bool, restore string) BranchResult {
+	result := BranchResult{Name: ref.name, Upstream: ref.upstream}
+
+	ahead := strings.Contains(ref.track, "ahead")
+	behind := strings.Contains(ref.track, "behind")
+
+	switch {
+	case ref.track == "gone":
+		result.Status = BranchUpstreamGone
+	case ref.track == "":
+		result.Status = BranchUpToDate
+	case strategy == StrategyReset:
+		if checkedOut {
+			result.update(BranchReset, gitRun(ctx, dir, "reset", "--hard", "--quiet", ref.upstreamRef))
+		} else {
+			result.update(BranchReset, gitRun(ctx, dir, "update-ref", "refs/heads/"+ref.name, ref.upstreamRef, ref.sha))
+		}
+	case strategy == StrategyFetch && behind && !ahead:
+		result.Status = BranchBehind
+	case ahead && behind:
+		result.Status = BranchDiverged
+
+		if strategy != StrategyRebase {
+			break
+		}
+
+		if !result.clean(ctx, dir) || (!checkedOut && restore == "") {
+			break
+		}
+
+		if checkedOut {
+			result.rebase(ctx, dir, ref.upstreamRef)
+		} else {
+			result.rebase(ctx, dir, ref.upstreamRef, ref.name)
+
+			// Rebasing, or aborting the rebase, leaves the branch checked out
+			cleanupCtx, cancel := cleanupContext()
+			err := gitRun(cleanupCtx, dir, "checkout", "--quiet", restore)
+			cancel()
+
+			if err != nil {
+				result.Status = BranchFailed
+				result.Message = err.Error()
+			}
+		}
+	case ahead:
+		result.Status = BranchAhead
+	case checkedOut:
+		if result.clean(ctx, dir) {
+			result.update(BranchUpdated, gitRun(ctx, dir, "merge", "--ff-only", "--quiet", ref.upstreamRef))
+		}
+	default:
+		// Only move the branch if nothing else has moved it since we looked
+		result.update(BranchUpdated, gitRun(ctx, dir, "update-ref", "refs/heads/"+ref.name, ref.upstreamRef, ref.sha))
+	}
+
+	return result
+}
+
+// clean reports whether the working tree at dir has no uncommitted changes,
+// setting the status of the branch if it can't be updated because of them.
+func (b *BranchResult) clean(ctx context.Context, dir string) bool {
+	changes, err := gitOutput(ctx, dir, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		b.Status = BranchFailed
+		b.Message = err.Error()
+
+		return false
+	}
+
+	if len(changes) > 0 {
+		b.Status = BranchUncommitted
+		return false
+	}
+
+	return true
+}
+
+// rebase rebases the branch onto upstream, aborting if the rebase fails, times
+// out or is cancelled so the branch is left as it was.
+func (b *BranchResult) rebase(ctx context.Context, dir string, args ...string) {
+	err := gitRun(ctx, dir, append([]string{"rebase", "--quiet"}, args...)...)
+	if err != nil {
+		cleanupCtx, cancel := cleanupContext()
+		defer cancel()
+
+		//nolint:errcheck
+		gitRun(cleanupCtx, dir, "rebase", "--abort")
+
+		b.Message = fmt.Sprintf("rebase failed and was aborted: %s", err)
+
+		return
+	}
+
+	b.Status = BranchRebased
+}
+
+func (b *BranchResult) update(status BranchStatus, err error) {
+	if err != nil {
+		b.Status = BranchFailed
+		b.Message = err.Error()
+
+		return
+	}
+
+	b.Status = status
+}
+
+func (b BranchResult) String() string {
+	s := fmt.Sprintf("%s: %s", b.Name, b.Status)
+
+	switch b.Status {
+	case BranchDiverged:
+		s = fmt.Sprintf("%s: diverged from %s", b.Name, b.Upstream)
+	case BranchUpstreamGone:
+		s = fmt.Sprintf("%s: upstream %s deleted", b.Name, b.Upstream)
+	}
+
+	if b.Message != "" {
+		s = fmt.Sprintf("%s (%s)", s, b.Message)
+	}
+
+	return s
+}
+
+func (repo *Repo) fail(message string) {
+	repo.Severity = Error
+	repo.Message = message
+}
@@ -0,0 +1,277 @@
+package actions
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// createSyncTestRepos creates an upstream and a local clone with main,
+// feature, diverged, gone and ahead branches in each of those states
+func createSyncTestRepos(t *testing.T) (string, string) {
+	testDir := CreateTestDirs()
+
+	// An upstream with main, feature, diverged and gone branches
+	runGit(t, testDir, "init", "--bare", "--initial-branch=main", "remote.git")
+	runGit(t, testDir, "clone", "remote.git", "upstream")
+	upstream := testDir + "/upstream"
+	commit(t, upstream, "first")
+	for _, b := range []string{"main", "main:feature", "main:diverged", "main:gone", "main:ahead"} {
+		runGit(t, upstream, "push", "origin", b)
+	}
+
+	runGit(t, testDir, "clone", "remote.git", "local")
+	local := testDir + "/local"
+	for _, b := range []string{"feature", "diverged", "gone", "ahead"} {
+		runGit(t, local, "branch", "--track", b, "origin/"+b)
+	}
+	runGit(t, local, "checkout", "-q", "diverged")
+	commit(t, local, "local change")
+	runGit(t, local, "checkout", "-q", "ahead")
+	commit(t, local, "local change")
+	runGit(t, local, "checkout", "-q", "main")
+
+	commit(t, upstream, "second")
+	runGit(t, upstream, "push", "origin", "main", "main:feature", "main:diverged", "--force")
+	runGit(t, upstream, "push", "origin", "--delete", "gone")
+
+	return testDir, local
+}
+
+func TestSyncReposBranches(t *testing.T) {
+	testDir, local := createSyncTestRepos(t)
+	defer os.RemoveAll(testDir)
+
+	repos := Repos{
+		&Repo{
+			Name: "local",
+		},
+	}
+	repos.SyncRepos(context.Background(), testDir)
+
+	assert.Equal(t, Warning, repos[0].Severity)
+	assert.Equal(t, []BranchResult{
+		{Name: "ahead", Upstream: "origin/ahead", Status: BranchAhead},
+		{Name: "diverged", Upstream: "origin/diverged", Status: BranchDiverged},
+		{Name: "feature", Upstream: "origin/feature", Status: BranchUpdated},
+		{Name: "gone", Upstream: "origin/gone", Status: BranchUpstreamGone},
+		{Name: "main", Upstream: "origin/main", Status: BranchUpdated},
+	}, repos[0].Branches)
+	assert.Equal(
+		t,
+		"ahead: ahead of upstream\ndiverged: diverged from origin/diverged\nfeature: updated\ngone: upstream origin/gone deleted\nmain: updated",
+		repos[0].Message,
+	)
+	assert.FileExists(t, local+"/second")
+}
+
+func TestSyncReposStrategies(t *testing.T) {
+	defer viper.Set("strategy", "")
+
+	// Rebasing creates commits
+	for _, env := range []string{"GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL"} {
+		os.Setenv(env, "test@example.com")
+		defer os.Unsetenv(env)
+	}
+
+	type testCase struct {
+		strategy         Strategy
+		expectedBranches []BranchResult
+		expectedUpdated  bool
+	}
+	testCases := []testCase{
+		{
+			strategy: StrategyFetch,
+			expectedBranches: []BranchResult{
+				{Name: "ahead", Upstream: "origin/ahead", Status: BranchAhead},
+				{Name: "diverged", Upstream: "origin/diverged", Status: BranchDiverged},
+				{Name: "feature", Upstream: "origin/feature", Status: BranchBehind},
+				{Name: "gone", Upstream: "origin/gone", Status: BranchUpstreamGone},
+				{Name: "main", Upstream: "origin/main", Status: BranchBehind},
+			},
+		},
+		{
+			strategy: StrategyRebase,
+			expectedBranches: []BranchResult{
+				{Name: "ahead", Upstream: "origin/ahead", Status: BranchAhead},
+				{Name: "diverged", Upstream: "origin/diverged", Status: BranchRebased},
+				{Name: "feature", Upstream: "origin/feature", Status: BranchUpdated},
+				{Name: "gone", Upstream: "origin/gone", Status: BranchUpstreamGone},
+				{Name: "main", Upstream: "origin/main", Status: BranchUpdated},
+			},
+			expectedUpdated: true,
+		},
+		{
+			strategy: StrategyReset,
+			expectedBranches: []BranchResult{
+				{Name: "ahead", Upstream: "origin/ahead", Status: BranchReset},
+				{Name: "diverged", Upstream: "origin/diverged", Status: BranchReset},
+				{Name: "feature", Upstream: "origin/feature", Status: BranchReset},
+				{Name: "gone", Upstream: "origin/gone", Status: BranchUpstreamGone},
+				{Name: "main", Upstream: "origin/main", Status: BranchReset},
+			},
+			expectedUpdated: true,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(string(tc.strategy), func(t *testing.T) {
+			testDir, local := createSyncTestRepos(t)
+			defer os.RemoveAll(testDir)
+
+			viper.Set("strategy", string(tc.strategy))
+			repos := Repos{
+				&Repo{
+					Name: "local",
+				},
+			}
+			repos.SyncRepos(context.Background(), testDir)
+
+			assert.Equal(t, tc.expectedBranches, repos[0].Branches)
+
+			if tc.expectedUpdated {
+				assert.FileExists(t, local+"/second")
+			} else {
+				assert.NoFileExists(t, local+"/second")
+			}
+
+			current, err := gitOutput(context.Background(), local, "symbolic-ref", "--short", "HEAD")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"main"}, current)
+		})
+	}
+}
+
+func TestSyncReposRebaseTimeout(t *testing.T) {
+	testDir, local := createSyncTestRepos(t)
+	defer os.RemoveAll(testDir)
+
+	for _, env := range []string{"GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL"} {
+		os.Setenv(env, "test@example.com")
+		defer os.Unsetenv(env)
+	}
+
+	viper.Set("strategy", string(StrategyRebase))
+	defer viper.Set("strategy", "")
+	viper.Set("timeout", time.Second)
+	defer viper.Set("timeout", 0)
+
+	// Hangs the first commit the rebase makes so it times out part way through
+	hook := local + "/.git/hooks/prepare-commit-msg"
+	err := ioutil.WriteFile(
+		hook,
+		[]byte("#!/bin/sh\nexec >/dev/null 2>&1\nhang=$(git rev-parse --git-dir)/hang\n[ -f $hang ] || exit 0\nrm $hang\nsleep 3\n"),
+		0700,
+	)
+	assert.NoError(t, err)
+	_, err = os.Create(local + "/.git/hang")
+	assert.NoError(t, err)
+	runGit(t, local, "config", "core.hooksPath", ".git/hooks")
+
+	diverged, err := gitOutput(context.Background(), local, "rev-parse", "diverged")
+	assert.NoError(t, err)
+
+	repos := Repos{
+		&Repo{
+			Name: "local",
+		},
+	}
+	repos.SyncRepos(context.Background(), testDir)
+
+	assert.Equal(t, "timed out after 1s", repos[0].Message)
+	assert.NoFileExists(t, local+"/.git/hang")
+	assert.NoDirExists(t, local+"/.git/rebase-merge")
+
+	current, err := gitOutput(context.Background(), local, "symbolic-ref", "--short", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main"}, current)
+
+	after, err := gitOutput(context.Background(), local, "rev-parse", "diverged")
+	assert.NoError(t, err)
+	assert.Equal(t, diverged, after)
+}
+
+func TestSyncReposUncommitted(t *testing.T) {
+	testDir := CreateTestDirs()
+	defer os.RemoveAll(testDir)
+
+	runGit(t, testDir, "init", "--bare", "--initial-branch=main", "remote.git")
+	runGit(t, testDir, "clone", "remote.git", "upstream")
+	upstream := testDir + "/upstream"
+	commit(t, upstream, "first")
+	runGit(t, upstream, "push", "origin", "main")
+
+	runGit(t, testDir, "clone", "remote.git", "local")
+	local := testDir + "/local"
+	err := ioutil.WriteFile(local+"/first", []byte("wip"), 0600)
+	assert.NoError(t, err)
+
+	commit(t, upstream, "second")
+	runGit(t, upstream, "push", "origin", "main")
+
+	repos := Repos{
+		&Repo{
+			Name: "local",
+		},
+	}
+	repos.SyncRepos(context.Background(), testDir)
+
+	assert.Equal(t, Warning, repos[0].Severity)
+	assert.Equal(t, "main: has uncommitted changes", repos[0].Message)
+	assert.NoFileExists(t, local+"/second")
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %s", args, output)
+	}
+}
+
+// commit creates and commits a file called name in the repo at dir
+func commit(t *testing.T, dir, name string) {
+	t.Helper()
+
+	_, err := os.Create(dir + "/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runGit(t, dir, "add", name)
+	runGit(t, dir, "commit", "-q", "-m", name)
+}
+
+func TestSyncReposBare(t *testing.T) {
+	testDir, _ := createSyncTestRepos(t)
+	defer os.RemoveAll(testDir)
+
+	runGit(t, testDir, "init", "--bare", "--quiet", "--initial-branch=main", "bare")
+	bare := testDir + "/bare"
+	runGit(t, bare, "remote", "add", "origin", testDir+"/remote.git")
+	runGit(t, bare, "fetch", "--quiet", "origin")
+	runGit(t, bare, "branch", "main", "origin/main~1")
+	runGit(t, bare, "branch", "--set-upstream-to=origin/main", "main")
+
+	repos := Repos{
+		&Repo{
+			Name: "bare",
+		},
+	}
+	repos.SyncRepos(context.Background(), testDir)
+
+	assert.Equal(t, Info, repos[0].Severity)
+	assert.Equal(t, []BranchResult{
+		{Name: "main", Upstream: "origin/main", Status: BranchUpdated},
+	}, repos[0].Branches)
+}
@@ -0,0 +1,236 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	configDirName        = "git-mass-sync"
+	configFileName       = "config.yaml"
+	targetConfigFileName = ".git-mass-sync.yaml"
+	// targetDirArg is the annotation giving the index of the arg that is the
+	// target dir of a command, used to find its config file
+	targetDirArg = "targetDirArg"
+	// planFileArg is the annotation giving the index of the arg that is a plan
+	// file, whose download dir is the target dir of the command
+	planFileArg = "planFileArg"
+)
+
+// configSources records which config file each setting was loaded from
+var configSources = map[string]string{}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the settings loaded from flags, env vars and config files",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show [target dir]",
+	Short: "Print the effective value of every setting and where it came from",
+	Example: `To see the settings used when syncing ~/download/dir with the work profile
+> git-mass-sync config show ~/download/dir --profile work`,
+	//nolint:gomnd
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: map[string]string{targetDirArg: "0"},
+	Run: func(cmd *cobra.Command, args []string) {
+		showConfig(cmd)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+
+	rootCmd.PersistentFlags().String("config", "", "Config file to use instead of $XDG_CONFIG_HOME/git-mass-sync/config.yaml")
+	rootCmd.PersistentFlags().String("profile", "", "Named profile from the config files to apply")
+}
+
+// loadConfig merges the settings from the user's config file and the target
+// dir's config file into viper. Flags and env vars still take precedence.
+func loadConfig(cmd *cobra.Command, args []string) error {
+	configFile, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return err
+	}
+
+	profile, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		return err
+	}
+
+	settings, sources, err := readConfig(configFile, profile, targetDir(cmd, args))
+	if err != nil {
+		return err
+	}
+
+	configSources = sources
+
+	return viper.MergeConfigMap(settings)
+}
+
+// readConfig reads configFile, or the user's config file if not set, and then
+// the config file in targetDir, which overrides it. Settings in profile
+// override the top level settings of the same file. It returns the merged
+// settings and the file each came from.
+func readConfig(configFile, profile, targetDir string) (map[string]interface{}, map[string]string, error) {
+	settings := map[string]interface{}{}
+	sources := map[string]string{}
+
+	var files []string
+
+	required := configFile != ""
+	if required {
+		files = append(files, configFile)
+	} else if path := userConfigFile(); path != "" {
+		files = append(files, path)
+	}
+
+	if targetDir != "" {
+		files = append(files, filepath.Join(targetDir, targetConfigFileName))
+	}
+
+	profileFound := profile == ""
+
+	for i, path := range files {
+		if _, err := os.Stat(path); os.IsNotExist(err) && !(required && i == 0) {
+			continue
+		}
+
+		v := viper.New()
+		v.SetConfigFile(path)
+
+		err := v.ReadInConfig()
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "unable to read config file %s", path)
+		}
+
+		for key, value := range v.AllSettings() {
+			if key == "profiles" {
+				continue
+			}
+
+			settings[key] = value
+			sources[key] = path
+		}
+
+		if profile == "" {
+			continue
+		}
+
+		if p := v.Sub("profiles." + profile); p != nil {
+			profileFound = true
+
+			for key, value := range p.AllSettings() {
+				settings[key] = value
+				sources[key] = fmt.Sprintf("%s (profile %s)", path, profile)
+			}
+		}
+	}
+
+	if !profileFound {
+		return nil, nil, fmt.Errorf("profile [%s] not found in config files %v", profile, files)
+	}
+
+	return settings, sources, nil
+}
+
+// userConfigFile returns the path of the user's config file, which may not exist
+func userConfigFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, configDirName, configFileName)
+}
+
+// targetDir returns the target dir arg of cmd, or the download dir of its plan
+// file arg, if it has one
+func targetDir(cmd *cobra.Command, args []string) string {
+	if i, err := strconv.Atoi(cmd.Annotations[planFileArg]); err == nil && i < len(args) {
+		return planDir(args[i])
+	}
+
+	i, err := strconv.Atoi(cmd.Annotations[targetDirArg])
+	if err != nil || i >= len(args) {
+		return ""
+	}
+
+	return expandHome(args[i])
+}
+
+// settingSource describes where the value of the setting key came from
+func settingSource(cmd *cobra.Command, key string) string {
+	if f := cmd.Flags().Lookup(key); f != nil && f.Changed {
+		return "flag --" + key
+	}
+
+	// viper.AutomaticEnv looks up settings in env vars named after the key
+	env := strings.ToUpper(key)
+	if _, ok := os.LookupEnv(env); ok {
+		return "env " + env
+	}
+
+	if source, ok := configSources[key]; ok {
+		return source
+	}
+
+	return "default"
+}
+
+// showConfig prints every setting that can be set by a flag or was set in a
+// config file with its effective value and where the value came from.
+func showConfig(cmd *cobra.Command) {
+	defaults := map[string]string{}
+
+	var visit func(c *cobra.Command)
+	visit = func(c *cobra.Command) {
+		c.LocalFlags().VisitAll(func(f *pflag.Flag) {
+			if f.Name != "help" && f.Name != "config" && f.Name != "profile" && !f.Hidden && f.Deprecated == "" {
+				defaults[f.Name] = f.DefValue
+			}
+		})
+
+		for _, child := range c.Commands() {
+			visit(child)
+		}
+	}
+	visit(rootCmd)
+
+	for key := range configSources {
+		if _, ok := defaults[key]; !ok {
+			defaults[key] = ""
+		}
+	}
+
+	keys := make([]string, 0, len(defaults))
+	for key := range defaults {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := defaults[key]
+		if viper.IsSet(key) {
+			value = fmt.Sprint(viper.Get(key))
+		}
+
+		fmt.Fprintf(out, "%s = %q (%s)\n", key, value, settingSource(cmd, key))
+	}
+}
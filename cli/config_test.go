@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	defer os.Setenv("XDG_CONFIG_HOME", xdg)
+	os.Setenv("XDG_CONFIG_HOME", dir+"/xdg")
+
+	userConfig := dir + "/xdg/git-mass-sync/config.yaml"
+	assert.NoError(t, os.MkdirAll(dir+"/xdg/git-mass-sync", 0755))
+	assert.NoError(t, ioutil.WriteFile(userConfig, []byte(`
+parallelism: 8
+exclude: "-old$"
+profiles:
+  work:
+    strategy: rebase
+    exclude: "^tmp-"
+`), 0644))
+
+	targetConfig := dir + "/target/.git-mass-sync.yaml"
+	assert.NoError(t, os.MkdirAll(dir+"/target", 0755))
+	assert.NoError(t, ioutil.WriteFile(targetConfig, []byte(`
+parallelism: 4
+archive-dir: /archive
+`), 0644))
+
+	settings, sources, err := readConfig("", "", dir+"/target")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"parallelism": 4, "exclude": "-old$", "archive-dir": "/archive"}, settings)
+	assert.Equal(t, map[string]string{"parallelism": targetConfig, "exclude": userConfig, "archive-dir": targetConfig}, sources)
+
+	settings, sources, err = readConfig("", "work", "")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"parallelism": 8, "exclude": "^tmp-", "strategy": "rebase"}, settings)
+	assert.Equal(t, userConfig+" (profile work)", sources["strategy"])
+
+	// --config replaces the user config file
+	settings, _, err = readConfig(targetConfig, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"parallelism": 4, "archive-dir": "/archive"}, settings)
+
+	_, _, err = readConfig("", "home", dir+"/target")
+	assert.EqualError(t, err, "profile [home] not found in config files ["+userConfig+" "+targetConfig+"]")
+
+	_, _, err = readConfig(dir+"/missing.yaml", "", "")
+	assert.Error(t, err)
+
+	// Missing default config files are fine
+	settings, _, err = readConfig("", "", dir+"/missing")
+	assert.NoError(t, err)
+	assert.Equal(t, 8, settings["parallelism"])
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/spf13/viper"
+)
+
+// Exit codes so scripts can tell how a run went
+const (
+	exitOK = iota
+	// exitWarning is only used with --fail-on=warning
+	exitWarning
+	exitError
+	// exitListing means the remote repo list could not be fetched
+	exitListing
+	// exitAborted means the run was stopped by a safety check before doing anything
+	exitAborted
+	// The conventional exit code for a process killed by SIGINT
+	exitInterrupted = 130
+)
+
+const (
+	failOnWarning = "warning"
+	failOnError   = "error"
+)
+
+func checkFailOn() error {
+	switch viper.GetString("fail-on") {
+	case failOnWarning, failOnError:
+		return nil
+	}
+
+	return fmt.Errorf("unknown --fail-on [%s], must be one of [%s %s]", viper.GetString("fail-on"), failOnWarning, failOnError)
+}
+
+// exitCode returns the exit code for a run with the results in groups
+func exitCode(groups []resultGroup) int {
+	worst := actions.Info
+
+	for _, g := range groups {
+		for _, repo := range g.repos {
+			if repo.Severity > worst {
+				worst = repo.Severity
+			}
+		}
+	}
+
+	switch {
+	case worst == actions.Error:
+		return exitError
+	case worst == actions.Warning && viper.GetString("fail-on") == failOnWarning:
+		return exitWarning
+	}
+
+	return exitOK
+}
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitCode(t *testing.T) {
+	defer viper.Set("fail-on", failOnError)
+
+	ok := resultGroup{repos: actions.Repos{&actions.Repo{Severity: actions.Info}}}
+	warning := resultGroup{repos: actions.Repos{&actions.Repo{Severity: actions.Warning}}}
+	failed := resultGroup{repos: actions.Repos{&actions.Repo{Severity: actions.Error}}}
+
+	viper.Set("fail-on", failOnError)
+	assert.Equal(t, exitOK, exitCode([]resultGroup{ok}))
+	assert.Equal(t, exitOK, exitCode([]resultGroup{ok, warning}))
+	assert.Equal(t, exitError, exitCode([]resultGroup{ok, warning, failed}))
+
+	viper.Set("fail-on", failOnWarning)
+	assert.Equal(t, exitOK, exitCode([]resultGroup{ok}))
+	assert.Equal(t, exitWarning, exitCode([]resultGroup{ok, warning}))
+	assert.Equal(t, exitError, exitCode([]resultGroup{failed, warning}))
+}
+
+func TestPlanFailed(t *testing.T) {
+	assert.Equal(t, exitAborted, planFailed(archiveLimitError{errors.New("too many")}))
+	assert.Equal(t, exitError, planFailed(errors.New("unable to read dir")))
+}
@@ -19,34 +19,19 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
-	"regexp"
+	"strings"
 	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/lhopki01/git-mass-sync/actions"
-	"github.com/mitchellh/colorstring"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"golang.org/x/oauth2"
 )
 
-type HTTPClient interface {
-	Do(req *http.Request) (*http.Response, error)
-}
-
-type action int
-
-const (
-	actionClone action = iota
-	actionSync
-	actionArchive
-	actionCloneArchive
-	actionNone
-)
-
 type idType int
 
 const (
@@ -55,37 +40,51 @@ const (
 	unknown
 )
 
-const reposPerPage = 100
+const (
+	reposPerPage     = 100
+	maxSearchResults = 1000
+)
 
 // githubCmd represents the base command when called without any subcommands
-var githubCmd = &cobra.Command{
-	Use:   "github [org|user] [download dir]",
-	Short: "Download all repos from a github organization or user",
-	//nolint:gomnd
-	Args: cobra.ExactArgs(2),
-	Example: `To download all repos for user lhopki01
+var githubCmd = newGithubCmd(runProvider)
+
+// newGithubCmd returns a github command that passes the provider to run
+func newGithubCmd(run func(p Provider, args []string)) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "github [org|user] [download dir]",
+		Short: "Download all repos from a github organization or user",
+		//nolint:gomnd
+		Args:        cobra.ExactArgs(2),
+		Annotations: map[string]string{targetDirArg: "1"},
+		Example: `To download all repos for user lhopki01
 > git-mass-sync github lhopki01 ~/path/to/download/directory
 
 To download all repos for user lhopki01 with topic team-foobar
 > git-mass-sync github lhopki01 ~/download/dir --search "topic:team-foobar"
 
 To download all repos for org foobar excluding forks and archived repos
-> git-mass-sync github foobar ~/download/dir --search "archived:false forks:false"`,
-	Run: func(cmd *cobra.Command, args []string) {
-		runGithub(args)
-	},
+> git-mass-sync github foobar ~/download/dir --search "archived:false fork:false"`,
+		Run: func(cmd *cobra.Command, args []string) {
+			githubURL := viper.GetString("github-url")
+			if githubURL == "" {
+				githubURL = os.Getenv("GITHUB_GMS_URL")
+			}
+			run(githubProvider{baseURL: githubURL}, args)
+		},
+	}
+
+	addProviderFlags(cmd)
+	cmd.Flags().StringP("search", "s", "", "Github search string to use. Search strings are exactly the same as used on github.com\nQualifiers other than archived, fork, is, topic and language use the\nsearch api which fails if more than 1000 repos match")
+	cmd.Flags().String("private", "", `DEPRECATED use [--search "is:public"] instead`)
+	cmd.Flags().String("forks", "", `DEPRECATED use [--search "fork:false"] instead`)
+	cmd.Flags().String("github-url", "", "Base url of a Github Enterprise Server instance\n(default is github.com or the GITHUB_GMS_URL env var)")
+
+	return cmd
 }
 
 func init() {
 	rootCmd.AddCommand(githubCmd)
 
-	githubCmd.Flags().String("include", ".*", "Regex to match repo names against")
-	githubCmd.Flags().String("exclude", "^$", "Regex to exclude repo names against")
-	githubCmd.Flags().String("archive-dir", "", "Repo to put archived repos in\n(default is .archive in the download dir)")
-	githubCmd.Flags().StringP("search", "s", "", "Github search string to use. Search strings are exactly the same as used on github.com")
-	githubCmd.Flags().String("private", "", `DEPRECATED use [--search "is:public"] instead`)
-	githubCmd.Flags().String("forks", "", `DEPRECATED use [--search "fork:false"] instead`)
-
 	err := viper.BindPFlags(githubCmd.Flags())
 	if err != nil {
 		log.Fatalf("Binding flags failed: %s", err)
@@ -94,269 +93,142 @@ func init() {
 	viper.AutomaticEnv()
 }
 
-func processFlags(args []string) (string, string, string, *regexp.Regexp, *regexp.Regexp) {
-	if viper.GetString("private") != "" {
-		colorstring.Print("[red][--private=false] flag is deprecated please use [--search \"is:public\"] instead")
-		fmt.Println("")
-	}
-	if viper.GetString("forks") != "" {
-		colorstring.Print("[red][--forks=false] flag is deprecated please use [--search \"forks:false\"] instead")
-		fmt.Println("")
-	}
-
-	id := args[0]
-
-	dir := filepath.Clean(args[1])
-
-	fmt.Println("=============")
-	fmt.Printf("Syncing %s into %s\n", id, dir)
-
-	archiveDir := viper.GetString("archive-dir")
-	if archiveDir == "" {
-		archiveDir = fmt.Sprintf("%s/.archive", dir)
-	} else {
-		archiveDir = filepath.Clean(archiveDir)
-	}
-
-	fmt.Printf("Archiving repos into %s\n", archiveDir)
-
-	inR := regexp.MustCompile(viper.GetString("include"))
-	exR := regexp.MustCompile(viper.GetString("exclude"))
-
-	fmt.Println("=============")
-
-	return dir, archiveDir, id, inR, exR
+// githubProvider lists repos from github.com or, when baseURL is set, from a
+// Github Enterprise Server instance.
+type githubProvider struct {
+	baseURL string
 }
 
-func runGithub(args []string) {
-	dir, archiveDir, id, inR, exR := processFlags(args)
-
-	repoList := getRepoList(id)
-
-	if !viper.GetBool("verbose") {
-		fmt.Println("")
+func (p githubProvider) RepoList(id string) (actions.Repos, error) {
+	client, err := p.newClient()
+	if err != nil {
+		return nil, err
 	}
 
-	dirList := actions.GetGitDirList(dir)
-
-	reposToSync, reposToClone, reposToArchive := repoActions(repoList, dirList, archiveDir, inR, exR)
-
-	lenSync := len(reposToSync)
-	lenClone := len(reposToClone)
-	lenArchive := len(reposToArchive)
-
-	fmt.Println("=============")
-	colorstring.Printf("[green]%d repos to sync\n", lenSync)
-	colorstring.Printf("[cyan]%d repos to clone\n", lenClone)
-	colorstring.Printf("[light_magenta]%d repos to archive\n", lenArchive)
-	fmt.Println("=============")
-
-	// Order is very important here.  Clone must always come before archive
-	reposToSync.SyncRepos(dir)
-	reposToClone.CloneRepos(dir)
-	reposToArchive.ArchiveRepos(dir, archiveDir)
+	search := viper.GetString("search")
 
-	lenSyncWarnings := 0
-	warnings := false
+	var rs []github.Repository
 
-	for _, repo := range reposToSync {
-		if repo.Severity == actions.Warning {
-			if !warnings {
-				fmt.Println("=============")
-				//nolint:errcheck
-				colorstring.Println("[yellow]Warnings:")
-
-				warnings = true
-			}
-
-			colorstring.Printf("[green]Sync %s: [yellow]%s", repo.Name, repo.Message)
-			lenSyncWarnings++
+	filter, ok := parseSearch(search)
+	if ok {
+		rs, err = repoList(client, id)
+		if err != nil {
+			return nil, err
 		}
-	}
-	// No warnings from clone or archive
-	if warnings {
-		fmt.Println("=============")
-	}
-
-	lenSyncFailures, lenCloneFailures, lenArchiveFailures := 0, 0, 0
-	errors := false
 
-	for _, repo := range reposToSync {
-		if repo.Severity == actions.Error {
-			if !errors {
-				fmt.Println("=============")
-				//nolint:errcheck
-				colorstring.Println("[red]Errors:")
-
-				errors = true
-			}
-
-			colorstring.Printf("[green]Sync %s: [red]%s", repo.Name, repo.Message)
-			lenSyncFailures++
+		rs = filter.apply(rs)
+	} else {
+		// Qualifiers we can't apply ourselves have to go through the search
+		// api, which only ever returns the first 1000 results
+		rs, err = repoSearch(client, fmt.Sprintf("user:%s fork:true %s", id, search))
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	for _, repo := range reposToClone {
-		if repo.Severity == actions.Error {
-			if !errors {
-				fmt.Println("=============")
-				//nolint:errcheck
-				colorstring.Println("[red]Errors:")
-
-				errors = true
-			}
+	return convertToRepos(rs, githubHost(client)), nil
+}
 
-			colorstring.Printf("[cyan]Clone %s: [red]%s", repo.Name, repo.Message)
-			lenCloneFailures++
-		}
+func (p githubProvider) GetRepo(id, name string) (*actions.Repo, error) {
+	client, err := p.newClient()
+	if err != nil {
+		return nil, err
 	}
 
-	for _, repo := range reposToArchive {
-		if repo.Severity == actions.Error {
-			if !errors {
-				fmt.Println("=============")
-				//nolint:errcheck
-				colorstring.Println("[red]Errors:")
-
-				errors = true
-			}
-
-			colorstring.Printf("[light_magenta]Archive %s: [red]%s", repo.Name, repo.Message)
-			lenArchiveFailures++
+	r, resp, err := client.Repositories.Get(context.Background(), id, name)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, nil
 		}
-	}
 
-	if errors {
-		fmt.Println("=============")
+		return nil, errors.Wrapf(err, "unable to get github repo [%s/%s]", id, name)
 	}
 
-	if !viper.GetBool("dry-run") {
-		fmt.Println("=============")
-
-		if lenSyncFailures > 0 {
-			colorstring.Printf(
-				"[red]%d[reset]/[green]%d repos synced\n",
-				lenSync-lenSyncFailures,
-				lenSync,
-			)
-		} else if lenSync != 0 {
-			colorstring.Printf(
-				"[green]%d/%d repos synced\n",
-				lenSync-lenSyncFailures,
-				lenSync,
-			)
-		}
-
-		if lenCloneFailures > 0 {
-			colorstring.Printf("[red]%d[reset]/[cyan]%d repos cloned\n", lenClone-lenCloneFailures, lenClone)
-		} else if lenClone != 0 {
-			colorstring.Printf("[cyan]%d/%d repos cloned\n", lenClone-lenCloneFailures, lenClone)
-		}
-
-		if lenArchiveFailures > 0 {
-			colorstring.Printf("[red]%d[reset]/[light_magenta]%d repos archived\n", lenArchive-lenArchiveFailures, lenArchive)
-		} else if lenArchive != 0 {
-			colorstring.Printf("[light_magenta]%d/%d repos archived\n", lenArchive-lenArchiveFailures, lenArchive)
-		}
-	}
+	return convertToRepos([]github.Repository{*r}, githubHost(client))[0], nil
 }
 
-func repoAction(repo *actions.Repo, dirList []string) (action, []string) {
-	for i, dir := range dirList {
-		if dir == repo.Name {
-			if repo.Archived {
-				dirList = actions.RemoveElementFromSlice(dirList, i)
-				return actionArchive, dirList
-			}
-
-			dirList = actions.RemoveElementFromSlice(dirList, i)
-
-			return actionSync, dirList
-		}
+func (p githubProvider) newClient() (*github.Client, error) {
+	token, err := githubToken()
+	if err != nil {
+		return nil, err
 	}
 
-	if !repo.Archived {
-		return actionClone, dirList
-	} else if repo.Archived {
-		return actionCloneArchive, dirList
-	}
+	return newGithubClient(p.baseURL, token)
+}
 
-	return actionNone, dirList
+// Credentials returns the token to clone over https with
+func (p githubProvider) Credentials() actions.Credentials {
+	token, _ := githubToken()
+	return actions.Credentials{Username: "x-access-token", Token: token, Host: p.host()}
 }
 
-func repoActions(
-	repoList actions.Repos,
-	dirList []string,
-	archiveDir string,
-	inR *regexp.Regexp,
-	exR *regexp.Regexp,
-) (actions.Repos, actions.Repos, actions.Repos) {
-	var reposToSync actions.Repos
-
-	var reposToClone actions.Repos
-
-	var reposToArchive actions.Repos
-
-	for _, repo := range repoList {
-		if inR.MatchString(repo.Name) && !exR.MatchString(repo.Name) {
-			var a action
-
-			a, dirList = repoAction(repo, dirList)
-			switch a {
-			case actionArchive:
-				reposToArchive = append(reposToArchive, repo)
-			case actionSync:
-				reposToSync = append(reposToSync, repo)
-			case actionClone:
-				reposToClone = append(reposToClone, repo)
-			case actionCloneArchive:
-				if _, err := os.Stat(fmt.Sprintf("%s/%s", archiveDir, repo.Name)); os.IsNotExist(err) {
-					reposToArchive = append(reposToArchive, repo)
-					reposToClone = append(reposToClone, repo)
-				}
-			}
-		}
+// host returns the host serving git for the provider
+func (p githubProvider) host() string {
+	if p.baseURL == "" {
+		return "github.com"
 	}
 
-	for _, dir := range dirList {
-		reposToArchive = append(reposToArchive, &actions.Repo{
-			Name: dir,
-		})
+	u, err := url.Parse(p.baseURL)
+	if err != nil {
+		return ""
 	}
 
-	return reposToSync, reposToClone, reposToArchive
+	return strings.TrimPrefix(u.Hostname(), "api.")
 }
 
-func getRepoList(id string) actions.Repos {
-	fmt.Printf("Getting remote repo list")
-
-	ctx := context.Background()
-
+func githubToken() (string, error) {
 	token := os.Getenv("GITHUB_GMS_TOKEN")
 	if token == "" {
 		token = os.Getenv("GITHUB_TOKEN")
 		if token == "" {
-			log.Fatal("Cannot find Github Personal Access Token at env var GITHUB_GMS_TOKEN or GITHUB_TOKEN with 'repo' permissions")
+			return "", errors.New("Cannot find Github Personal Access Token at env var GITHUB_GMS_TOKEN or GITHUB_TOKEN with 'repo' permissions")
 		}
 	}
 
+	return token, nil
+}
+
+// githubHost returns the host serving the web ui and git for client
+func githubHost(client *github.Client) string {
+	return strings.TrimPrefix(client.BaseURL.Hostname(), "api.")
+}
+
+func newGithubClient(baseURL, token string) (*github.Client, error) {
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	tc := oauth2.NewClient(context.Background(), ts)
+
+	if baseURL == "" {
+		return github.NewClient(tc), nil
+	}
 
-	searchQuery := fmt.Sprintf("user:%s fork:true %s", id, viper.GetString("search"))
+	apiURL, err := githubEnterpriseAPIURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return github.NewEnterpriseClient(apiURL, apiURL, tc)
+}
 
-	rs, err := repoSearch(client, searchQuery)
+// githubEnterpriseAPIURL turns the url of a Github Enterprise Server host into
+// the url of its v3 api. Urls already pointing at the api are left alone.
+func githubEnterpriseAPIURL(baseURL string) (string, error) {
+	u, err := url.Parse(baseURL)
 	if err != nil {
-		fmt.Println("")
-		log.Fatal(err)
+		return "", errors.Wrapf(err, "invalid github url [%s]", baseURL)
 	}
 
-	repos := convertToRepos(rs)
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid github url [%s]: must include scheme and host", baseURL)
+	}
 
-	return repos
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	if !strings.HasSuffix(u.Path, "/api/v3") {
+		u.Path += "/api/v3"
+	}
+
+	return u.String() + "/", nil
 }
 
 func getIdType(client *github.Client, id string) (idType, error) {
@@ -373,12 +245,93 @@ func getIdType(client *github.Client, id string) (idType, error) {
 	return unknown, nil
 }
 
+// repoList lists every repo owned by the org or user id, consuming all the pages.
+func repoList(client *github.Client, id string) ([]github.Repository, error) {
+	t, err := getIdType(client, id)
+	if err != nil {
+		return nil, err
+	}
+
+	listPage := func(page int) ([]*github.Repository, *github.Response, error) {
+		opts := github.ListOptions{PerPage: reposPerPage, Page: page}
+		return client.Repositories.ListByOrg(context.Background(), id, &github.RepositoryListByOrgOptions{
+			Type:        "all",
+			ListOptions: opts,
+		})
+	}
+
+	if t == user {
+		self, _, err := client.Users.Get(context.Background(), "")
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to get authenticated github user")
+		}
+
+		// Only listing our own repos as the authenticated user includes private ones
+		listUser := id
+		if strings.EqualFold(self.GetLogin(), id) {
+			listUser = ""
+		}
+
+		listPage = func(page int) ([]*github.Repository, *github.Response, error) {
+			opts := github.ListOptions{PerPage: reposPerPage, Page: page}
+			if listUser == "" {
+				return client.Repositories.List(context.Background(), "", &github.RepositoryListOptions{
+					Affiliation: "owner",
+					ListOptions: opts,
+				})
+			}
+
+			return client.Repositories.List(context.Background(), listUser, &github.RepositoryListOptions{
+				Type:        "owner",
+				ListOptions: opts,
+			})
+		}
+	} else if t != org {
+		return nil, fmt.Errorf("[%s] is neither a github org nor a user", id)
+	}
+
+	var results []github.Repository
+
+	page := 1
+
+	for {
+		fmt.Fprint(out, ".")
+
+		rs, resp, err := listPage(page)
+		if err != nil {
+			if _, ok := err.(*github.AbuseRateLimitError); ok {
+				fmt.Fprint(out, "throttled, backing off")
+				//nolint:gomnd
+				time.Sleep(5 * time.Second)
+
+				continue
+			}
+
+			return nil, errors.Wrapf(err, "unable to list github repos for [%s]", id)
+		}
+
+		for _, r := range rs {
+			results = append(results, *r)
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		page = resp.NextPage
+	}
+
+	return results, nil
+}
+
 // RepoSearch performs a query against github, consumes all the pages and returns the aggregated results.
+// Github never returns more than 1000 results for a search so an error is
+// returned rather than a silently truncated list.
 func repoSearch(client *github.Client, query string) ([]github.Repository, error) {
 	var results []github.Repository
 	page := 1
 	for {
-		fmt.Print(".")
+		fmt.Fprint(out, ".")
 		res, resp, err := client.Search.Repositories(
 			context.Background(),
 			query,
@@ -391,7 +344,7 @@ func repoSearch(client *github.Client, query string) ([]github.Repository, error
 		)
 		if err != nil {
 			if _, ok := err.(*github.AbuseRateLimitError); ok {
-				fmt.Print("throttled, backing off")
+				fmt.Fprint(out, "throttled, backing off")
 				time.Sleep(5 * time.Second)
 				continue
 			}
@@ -399,6 +352,18 @@ func repoSearch(client *github.Client, query string) ([]github.Repository, error
 			return nil, errors.Wrap(err, "unable to perform github repository search request")
 		}
 
+		if res.GetIncompleteResults() {
+			return nil, errors.New("github search timed out and returned incomplete results, try again or narrow the search")
+		}
+
+		if res.GetTotal() > maxSearchResults {
+			return nil, fmt.Errorf(
+				"github search matched %d repos but only the first %d can be returned, narrow the search",
+				res.GetTotal(),
+				maxSearchResults,
+			)
+		}
+
 		page++
 		results = append(results, res.Repositories...)
 
@@ -410,13 +375,34 @@ func repoSearch(client *github.Client, query string) ([]github.Repository, error
 	return results, nil
 }
 
-func convertToRepos(rs []github.Repository) actions.Repos {
+// convertToRepos converts github repositories into repos. Github Enterprise
+// installs can omit the clone urls, in which case they are derived from host.
+func convertToRepos(rs []github.Repository, host string) actions.Repos {
 	var repos actions.Repos
 	for _, r := range rs {
+		sshURL := r.GetSSHURL()
+		if sshURL == "" {
+			sshURL = fmt.Sprintf("git@%s:%s.git", host, r.GetFullName())
+		}
+
+		httpsURL := r.GetCloneURL()
+		if httpsURL == "" {
+			httpsURL = fmt.Sprintf("https://%s/%s.git", host, r.GetFullName())
+		}
+
+		id := ""
+		if r.GetID() != 0 {
+			id = fmt.Sprintf("%s/%d", host, r.GetID())
+		}
+
 		repos = append(repos, &actions.Repo{
-			Name:     *r.Name,
-			SSHURL:   *r.SSHURL,
-			Archived: *r.Archived,
+			Name:     r.GetName(),
+			SSHURL:   sshURL,
+			HTTPSURL: httpsURL,
+			ID:       id,
+			Owner:    r.GetOwner().GetLogin(),
+			Host:     host,
+			Archived: r.GetArchived(),
 		})
 	}
 
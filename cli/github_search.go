@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// repoFilter applies the subset of github search qualifiers that can be
+// evaluated against a repo listing. A nil field means the qualifier was not
+// given.
+type repoFilter struct {
+	archived *bool
+	fork     *bool
+	private  *bool
+	topics   []string
+	language string
+	terms    []string
+}
+
+// parseSearch parses a github search string into a repoFilter. It returns
+// false if the search uses anything that can only be answered by the github
+// search api.
+func parseSearch(search string) (repoFilter, bool) {
+	var f repoFilter
+
+	for _, field := range strings.Fields(search) {
+		parts := strings.SplitN(field, ":", 2) //nolint:gomnd
+		if len(parts) == 1 {
+			f.terms = append(f.terms, strings.ToLower(field))
+			continue
+		}
+
+		key, value := strings.ToLower(parts[0]), strings.ToLower(parts[1])
+
+		switch {
+		case key == "archived" && (value == "true" || value == "false"):
+			f.archived = boolPtr(value == "true")
+		case key == "fork" && (value == "true" || value == "false"):
+			// fork:true includes forks, which listing does anyway
+			if value == "false" {
+				f.fork = boolPtr(false)
+			}
+		case key == "fork" && value == "only":
+			f.fork = boolPtr(true)
+		case key == "is" && (value == "public" || value == "private"):
+			f.private = boolPtr(value == "private")
+		case key == "is" && value == "archived":
+			f.archived = boolPtr(true)
+		case key == "is" && value == "fork":
+			f.fork = boolPtr(true)
+		case key == "topic" && value != "":
+			f.topics = append(f.topics, value)
+		case key == "language" && value != "":
+			f.language = value
+		default:
+			return repoFilter{}, false
+		}
+	}
+
+	return f, true
+}
+
+func (f repoFilter) apply(rs []github.Repository) []github.Repository {
+	var results []github.Repository
+
+	for _, r := range rs {
+		if f.matches(r) {
+			results = append(results, r)
+		}
+	}
+
+	return results
+}
+
+func (f repoFilter) matches(r github.Repository) bool {
+	if f.archived != nil && *f.archived != r.GetArchived() {
+		return false
+	}
+
+	if f.fork != nil && *f.fork != r.GetFork() {
+		return false
+	}
+
+	if f.private != nil && *f.private != r.GetPrivate() {
+		return false
+	}
+
+	if f.language != "" && f.language != strings.ToLower(r.GetLanguage()) {
+		return false
+	}
+
+	for _, topic := range f.topics {
+		if !containsFold(r.Topics, topic) {
+			return false
+		}
+	}
+
+	// Bare terms match the name or description the same way github does by default
+	text := strings.ToLower(r.GetName() + " " + r.GetDescription())
+	for _, term := range f.terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsFold(s []string, e string) bool {
+	for _, a := range s {
+		if strings.EqualFold(a, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearch(t *testing.T) {
+	_, ok := parseSearch("stars:>10")
+	assert.False(t, ok)
+
+	_, ok = parseSearch("")
+	assert.True(t, ok)
+
+	f, ok := parseSearch("archived:false fork:only is:private topic:team-foo language:Go bar")
+	assert.True(t, ok)
+	assert.Equal(t, repoFilter{
+		archived: boolPtr(false),
+		fork:     boolPtr(true),
+		private:  boolPtr(true),
+		topics:   []string{"team-foo"},
+		language: "go",
+		terms:    []string{"bar"},
+	}, f)
+}
+
+func TestRepoFilterApply(t *testing.T) {
+	rs := []github.Repository{
+		{Name: github.String("api"), Topics: []string{"team-foo"}, Language: github.String("Go")},
+		{Name: github.String("web"), Topics: []string{"team-bar"}, Language: github.String("Go")},
+		{Name: github.String("old-api"), Topics: []string{"team-foo"}, Archived: github.Bool(true)},
+		{Name: github.String("api-fork"), Topics: []string{"team-foo"}, Fork: github.Bool(true)},
+	}
+
+	type testCase struct {
+		tName         string
+		search        string
+		expectedNames []string
+	}
+	testCases := []testCase{
+		{
+			tName:         "no filter",
+			search:        "",
+			expectedNames: []string{"api", "web", "old-api", "api-fork"},
+		},
+		{
+			tName:         "topic",
+			search:        "topic:team-foo",
+			expectedNames: []string{"api", "old-api", "api-fork"},
+		},
+		{
+			tName:         "not archived and no forks",
+			search:        "topic:team-foo archived:false fork:false",
+			expectedNames: []string{"api"},
+		},
+		{
+			tName:         "language",
+			search:        "language:go",
+			expectedNames: []string{"api", "web"},
+		},
+		{
+			tName:         "term",
+			search:        "fork:true old",
+			expectedNames: []string{"old-api"},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+			f, ok := parseSearch(tc.search)
+			assert.True(t, ok)
+
+			var names []string
+			for _, r := range f.apply(rs) {
+				names = append(names, r.GetName())
+			}
+			assert.Equal(t, tc.expectedNames, names)
+		})
+	}
+}
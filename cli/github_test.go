@@ -1,138 +1,130 @@
 package cli
 
 import (
+	"fmt"
 	"net/http"
-	"regexp"
+	"net/http/httptest"
+	"os"
 	"testing"
 
 	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestRepoActions(t *testing.T) {
+type MockClient struct {
+	DoFunc func(req *http.Request) (*http.Response, error)
+}
+
+func (m *MockClient) Do(req *http.Request) (*http.Response, error) {
+	if m.DoFunc != nil {
+		return m.DoFunc(req)
+	}
+	// just in case you want default correct return value
+	return &http.Response{}, nil
+}
+
+func TestGithubEnterpriseAPIURL(t *testing.T) {
 	type testCase struct {
-		tName           string
-		repo            *actions.Repo
-		dirList         []string
-		expectedAction  action
-		expectedDirList []string
+		tName       string
+		baseURL     string
+		expectedURL string
+		expectedErr bool
 	}
 	testCases := []testCase{
 		{
-			tName: "repo to archive",
-			repo: &actions.Repo{
-				Name:     "archivedRepo",
-				Archived: true,
-				SSHURL:   "git@giturl/archivedRepo",
-			},
-			dirList:         []string{"archivedRepo", "syncRepo", "deletedRepo"},
-			expectedAction:  actionArchive,
-			expectedDirList: []string{"syncRepo", "deletedRepo"},
+			tName:       "host only",
+			baseURL:     "https://github.example.com",
+			expectedURL: "https://github.example.com/api/v3/",
 		},
 		{
-			tName: "repo to clone",
-			repo: &actions.Repo{
-				Name:     "cloneRepo",
-				Archived: false,
-				SSHURL:   "git@giturl/cloneRepo",
-			},
-			dirList:         []string{"archivedRepo", "syncRepo", "deletedRepo"},
-			expectedAction:  actionClone,
-			expectedDirList: []string{"archivedRepo", "syncRepo", "deletedRepo"},
+			tName:       "host with trailing slash",
+			baseURL:     "https://github.example.com/",
+			expectedURL: "https://github.example.com/api/v3/",
 		},
 		{
-			tName: "repo to sync",
-			repo: &actions.Repo{
-				Name:     "syncRepo",
-				Archived: false,
-				SSHURL:   "git@giturl/syncRepo",
-			},
-			dirList:         []string{"archivedRepo", "syncRepo", "deletedRepo"},
-			expectedAction:  actionSync,
-			expectedDirList: []string{"archivedRepo", "deletedRepo"},
+			tName:       "api url",
+			baseURL:     "https://github.example.com/api/v3/",
+			expectedURL: "https://github.example.com/api/v3/",
 		},
 		{
-			tName: "repo to clone and archive",
-			repo: &actions.Repo{
-				Name:     "cloneArchiveRepo",
-				Archived: true,
-				SSHURL:   "git@giturl/cloneArchiveRepo",
-			},
-			dirList:         []string{"archivedRepo", "syncRepo", "deletedRepo"},
-			expectedAction:  actionCloneArchive,
-			expectedDirList: []string{"archivedRepo", "syncRepo", "deletedRepo"},
+			tName:       "missing scheme",
+			baseURL:     "github.example.com",
+			expectedErr: true,
 		},
 	}
-	var repos actions.Repos
 	for _, tc := range testCases {
 		tc := tc
 		t.Run(tc.tName, func(t *testing.T) {
-			action, dirList := repoAction(tc.repo, tc.dirList)
-			assert.Equal(t, tc.expectedAction, action)
-			assert.Equal(t, tc.expectedDirList, dirList)
+			t.Parallel()
+			u, err := githubEnterpriseAPIURL(tc.baseURL)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedURL, u)
+			}
 		})
-		repos = append(repos, tc.repo)
 	}
+}
 
-	inR, _ := regexp.Compile(".*")
-	exR, _ := regexp.Compile("^$")
-	reposToSync, reposToClone, reposToArchive := repoActions(repos, []string{"archivedRepo", "syncRepo", "deletedRepo"}, "foobar", inR, exR)
+func TestGithubProviderEnterprise(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/users/foo", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"login": "foo", "type": "Organization"}`)
+	})
+	mux.HandleFunc("/api/v3/orgs/foo/repos", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"name": "repoB", "full_name": "foo/repoB", "owner": {"login": "foo"}, "archived": true}]`)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s/api/v3/orgs/foo/repos?page=2>; rel="next"`, "http://"+r.Host))
+		fmt.Fprint(w, `[
+			{"name": "repoA", "full_name": "foo/repoA", "owner": {"login": "foo"}, "ssh_url": "git@ghe.example.com:foo/repoA.git", "clone_url": "https://ghe.example.com/foo/repoA.git", "archived": false},
+			{"name": "forkA", "full_name": "foo/forkA", "ssh_url": "git@ghe.example.com:foo/forkA.git", "fork": true}
+		]`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
 
-	assert.Equal(t, actions.Repos{
-		&actions.Repo{
-			Name:   "syncRepo",
-			SSHURL: "git@giturl/syncRepo",
-		},
-	}, reposToSync)
+	os.Setenv("GITHUB_GMS_TOKEN", "secret")
+	defer os.Unsetenv("GITHUB_GMS_TOKEN")
 
-	assert.Equal(t, actions.Repos{
-		&actions.Repo{
-			Name:   "cloneRepo",
-			SSHURL: "git@giturl/cloneRepo",
-		},
-		&actions.Repo{
-			Name:     "cloneArchiveRepo",
-			Archived: true,
-			SSHURL:   "git@giturl/cloneArchiveRepo",
-		},
-	}, reposToClone)
+	viper.Set("search", "fork:false")
+	defer viper.Set("search", "")
 
+	repos, err := githubProvider{baseURL: server.URL}.RepoList("foo")
+	assert.NoError(t, err)
 	assert.Equal(t, actions.Repos{
 		&actions.Repo{
-			Name:     "archivedRepo",
-			Archived: true,
-			SSHURL:   "git@giturl/archivedRepo",
+			Name:     "repoA",
+			SSHURL:   "git@ghe.example.com:foo/repoA.git",
+			HTTPSURL: "https://ghe.example.com/foo/repoA.git",
+			Owner:    "foo",
+			Host:     "127.0.0.1",
 		},
 		&actions.Repo{
-			Name:     "cloneArchiveRepo",
+			Name:     "repoB",
+			SSHURL:   "git@127.0.0.1:foo/repoB.git",
+			HTTPSURL: "https://127.0.0.1/foo/repoB.git",
+			Owner:    "foo",
+			Host:     "127.0.0.1",
 			Archived: true,
-			SSHURL:   "git@giturl/cloneArchiveRepo",
 		},
-		&actions.Repo{
-			Name: "deletedRepo",
-		},
-	}, reposToArchive)
+	}, repos)
 }
 
-type MockClient struct {
-	DoFunc func(req *http.Request) (*http.Response, error)
-}
+func TestRepoSearchTruncated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v3/search/repositories", r.URL.Path)
+		fmt.Fprint(w, `{"total_count": 1001, "items": [{"name": "repoA"}]}`)
+	}))
+	defer server.Close()
 
-func (m *MockClient) Do(req *http.Request) (*http.Response, error) {
-	if m.DoFunc != nil {
-		return m.DoFunc(req)
-	}
-	// just in case you want default correct return value
-	return &http.Response{}, nil
-}
+	client, err := newGithubClient(server.URL, "secret")
+	assert.NoError(t, err)
 
-func TestProcessFlags(t *testing.T) {
-	dir, archiveDir, org, inR, exR := processFlags([]string{"foobar", "/tmp/foobar"})
-	assert.Equal(t, "/tmp/foobar", dir)
-	assert.Equal(t, "/tmp/foobar/.archive", archiveDir)
-	assert.Equal(t, "foobar", org)
-	expectedInR, _ := regexp.Compile(".*")
-	assert.Equal(t, expectedInR, inR)
-	expectedExR, _ := regexp.Compile("^$")
-	assert.Equal(t, expectedExR, exR)
+	_, err = repoSearch(client, "user:foo stars:>10")
+	assert.EqualError(t, err, "github search matched 1001 repos but only the first 1000 can be returned, narrow the search")
 }
@@ -0,0 +1,234 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const defaultGitlabURL = "https://gitlab.com"
+
+type gitlabProject struct {
+	ID        int             `json:"id"`
+	Path      string          `json:"path"`
+	SSHURL    string          `json:"ssh_url_to_repo"`
+	HTTPSURL  string          `json:"http_url_to_repo"`
+	Archived  bool            `json:"archived"`
+	Namespace gitlabNamespace `json:"namespace"`
+}
+
+type gitlabNamespace struct {
+	FullPath string `json:"full_path"`
+}
+
+var gitlabCmd = newGitlabCmd(runProvider)
+
+// newGitlabCmd returns a gitlab command that passes the provider to run
+func newGitlabCmd(run func(p Provider, args []string)) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gitlab [group] [download dir]",
+		Short: "Download all projects from a gitlab group and its subgroups",
+		//nolint:gomnd
+		Args:        cobra.ExactArgs(2),
+		Annotations: map[string]string{targetDirArg: "1"},
+		Example: `To download all projects in the group foobar and its subgroups
+> git-mass-sync gitlab foobar ~/path/to/download/directory
+
+To download all projects in the subgroup foobar/infra from a self-hosted gitlab
+> git-mass-sync gitlab foobar/infra ~/download/dir --gitlab-url https://gitlab.example.com`,
+		Run: func(cmd *cobra.Command, args []string) {
+			run(gitlabProvider{
+				client:  http.DefaultClient,
+				baseURL: viper.GetString("gitlab-url"),
+			}, args)
+		},
+	}
+
+	addProviderFlags(cmd)
+	cmd.Flags().String("gitlab-url", defaultGitlabURL, "Base url of the gitlab instance")
+
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(gitlabCmd)
+
+	err := viper.BindPFlags(gitlabCmd.Flags())
+	if err != nil {
+		log.Fatalf("Binding flags failed: %s", err)
+	}
+
+	viper.AutomaticEnv()
+}
+
+type gitlabProvider struct {
+	client  HTTPClient
+	baseURL string
+}
+
+func (p gitlabProvider) RepoList(group string) (actions.Repos, error) {
+	token, err := gitlabToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ps, err := gitlabProjects(p.client, p.baseURL, token, group)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertGitlabToRepos(ps, p.host()), nil
+}
+
+// host returns the host of the gitlab instance
+func (p gitlabProvider) host() string {
+	u, err := url.Parse(p.baseURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
+}
+
+func (p gitlabProvider) GetRepo(namespace, name string) (*actions.Repo, error) {
+	token, err := gitlabToken()
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf(
+		"%s/api/v4/projects/%s",
+		strings.TrimSuffix(p.baseURL, "/"),
+		url.PathEscape(namespace+"/"+name),
+	)
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to build gitlab project request")
+	}
+
+	req.Header.Set("PRIVATE-TOKEN", token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to perform gitlab project request")
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil
+	}
+
+	var project gitlabProject
+
+	err = decodeGitlabResponse(resp, &project)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get gitlab project [%s/%s]", namespace, name)
+	}
+
+	return convertGitlabToRepos([]gitlabProject{project}, p.host())[0], nil
+}
+
+// Credentials returns the token to clone over https with
+func (p gitlabProvider) Credentials() actions.Credentials {
+	token, _ := gitlabToken()
+	return actions.Credentials{Username: "oauth2", Token: token, Host: p.host()}
+}
+
+func gitlabToken() (string, error) {
+	token := os.Getenv("GITLAB_GMS_TOKEN")
+	if token == "" {
+		token = os.Getenv("GITLAB_TOKEN")
+		if token == "" {
+			return "", errors.New("Cannot find Gitlab Personal Access Token at env var GITLAB_GMS_TOKEN or GITLAB_TOKEN with 'read_api' permissions")
+		}
+	}
+
+	return token, nil
+}
+
+// gitlabProjects lists every project in group, including those in nested
+// subgroups, consuming all the pages of the gitlab api.
+func gitlabProjects(client HTTPClient, baseURL, token, group string) ([]gitlabProject, error) {
+	var results []gitlabProject
+
+	page := "1"
+
+	for page != "" {
+		fmt.Fprint(out, ".")
+
+		u := fmt.Sprintf(
+			"%s/api/v4/groups/%s/projects?include_subgroups=true&per_page=%d&page=%s",
+			strings.TrimSuffix(baseURL, "/"),
+			url.PathEscape(group),
+			reposPerPage,
+			page,
+		)
+
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to build gitlab projects request")
+		}
+
+		req.Header.Set("PRIVATE-TOKEN", token)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to perform gitlab projects request")
+		}
+
+		var ps []gitlabProject
+
+		err = decodeGitlabResponse(resp, &ps)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list projects for gitlab group [%s]", group)
+		}
+
+		results = append(results, ps...)
+
+		page = resp.Header.Get("X-Next-Page")
+	}
+
+	return results, nil
+}
+
+func decodeGitlabResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gitlab returned %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func convertGitlabToRepos(ps []gitlabProject, host string) actions.Repos {
+	var repos actions.Repos
+	for _, p := range ps {
+		id := ""
+		if p.ID != 0 {
+			id = fmt.Sprintf("%s/%d", host, p.ID)
+		}
+
+		repos = append(repos, &actions.Repo{
+			Name:     p.Path,
+			SSHURL:   p.SSHURL,
+			HTTPSURL: p.HTTPSURL,
+			ID:       id,
+			Owner:    p.Namespace.FullPath,
+			Host:     host,
+			Archived: p.Archived,
+		})
+	}
+
+	return repos
+}
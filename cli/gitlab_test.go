@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitlabProjects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v4/groups/foo/bar/projects", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("include_subgroups"))
+		assert.Equal(t, "secret", r.Header.Get("PRIVATE-TOKEN"))
+
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Header().Set("X-Next-Page", "2")
+			fmt.Fprint(w, `[{"path": "repoA", "ssh_url_to_repo": "git@gitlab/foo/bar/repoA.git", "http_url_to_repo": "https://gitlab/foo/bar/repoA.git", "archived": false, "namespace": {"full_path": "foo/bar"}}]`)
+		case "2":
+			w.Header().Set("X-Next-Page", "")
+			fmt.Fprint(w, `[{"path": "repoB", "ssh_url_to_repo": "git@gitlab/foo/bar/sub/repoB.git", "archived": true, "namespace": {"full_path": "foo/bar/sub"}}]`)
+		default:
+			t.Errorf("unexpected page %s", r.URL.Query().Get("page"))
+		}
+	}))
+	defer server.Close()
+
+	ps, err := gitlabProjects(server.Client(), server.URL+"/", "secret", "foo/bar")
+	assert.NoError(t, err)
+	assert.Equal(t, actions.Repos{
+		&actions.Repo{
+			Name:     "repoA",
+			SSHURL:   "git@gitlab/foo/bar/repoA.git",
+			HTTPSURL: "https://gitlab/foo/bar/repoA.git",
+			Owner:    "foo/bar",
+			Host:     "gitlab.com",
+		},
+		&actions.Repo{
+			Name:     "repoB",
+			SSHURL:   "git@gitlab/foo/bar/sub/repoB.git",
+			Owner:    "foo/bar/sub",
+			Host:     "gitlab.com",
+			Archived: true,
+		},
+	}, convertGitlabToRepos(ps, "gitlab.com"))
+}
+
+func TestGitlabProjectsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := gitlabProjects(server.Client(), server.URL, "secret", "missing")
+	assert.EqualError(t, err, "unable to list projects for gitlab group [missing]: gitlab returned 404 Not Found")
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/lhopki01/git-mass-sync/debug"
+)
+
+// layoutDirs works out which of the git repos found in dir are managed by
+// repoList when using a layout other than flat. Repos in the dir of one of
+// the owners in the list are managed, so syncing one org never archives the
+// repos of another. Repos left in the flat layout are moved into the layout
+// if their origin is one of the repos in the list. It returns the managed
+// repos, with moved repos at their new path, and the repos to move.
+func layoutDirs(dir string, repoList actions.Repos, dirList []string) ([]string, actions.Repos) {
+	var managed []string
+
+	var moves actions.Repos
+
+	listed := map[string]bool{}
+	owners := map[string]bool{}
+
+	for _, repo := range repoList {
+		listed[repo.Name] = true
+		owners[path.Dir(repo.Name)] = true
+	}
+
+	found := map[string]bool{}
+	for _, d := range dirList {
+		found[d] = true
+	}
+
+	// Repos that aren't in the layout yet, by the name they'd have when flat
+	flat := map[string]actions.Repos{}
+
+	for _, repo := range repoList {
+		if !found[repo.Name] {
+			flat[path.Base(repo.Name)] = append(flat[path.Base(repo.Name)], repo)
+		}
+	}
+
+	for _, d := range dirList {
+		switch {
+		case listed[d] || inOwnerDir(d, owners):
+			managed = append(managed, d)
+		case !strings.Contains(d, "/") && len(flat[d]) > 0:
+			repo := flatRepo(dir, d, flat[d])
+			if repo == nil {
+				debug.Debugf("[%s] has the name of a repo in the list but not its origin", d)
+				continue
+			}
+
+			repo.OldName = d
+			moves = append(moves, repo)
+			managed = append(managed, repo.Name)
+		default:
+			debug.Debugf("[%s] is not managed by this repo list", d)
+		}
+	}
+
+	return managed, moves
+}
+
+// inOwnerDir reports whether the repo at path d is in the dir of one of owners
+func inOwnerDir(d string, owners map[string]bool) bool {
+	for dir := path.Dir(d); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if owners[dir] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flatRepo returns the repo in candidates that the repo at dir/name was
+// cloned from, if any
+func flatRepo(dir, name string, candidates actions.Repos) *actions.Repo {
+	url, err := actions.RemoteURL(context.Background(), fmt.Sprintf("%s/%s", dir, name))
+	if err != nil {
+		debug.Debugf("[%s] unable to get origin url: %s", name, err)
+		return nil
+	}
+
+	for _, repo := range candidates {
+		if repo.HasURL(url) {
+			return repo
+		}
+	}
+
+	return nil
+}
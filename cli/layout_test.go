@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayoutDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	origins := map[string]string{
+		"docs":     "git@github.com:foo/docs.git",
+		"infra":    "git@github.com:baz/infra.git",
+		"other":    "git@github.com:foo/other.git",
+		"foo/api":  "git@github.com:foo/api.git",
+		"foo/gone": "git@github.com:foo/gone.git",
+		"bar/docs": "git@github.com:bar/docs.git",
+	}
+	for repo, origin := range origins {
+		initRepo(t, dir+"/"+repo)
+		runGit(t, dir+"/"+repo, "remote", "add", "origin", origin)
+	}
+
+	docs := &actions.Repo{Name: "foo/docs", SSHURL: "git@github.com:foo/docs.git"}
+	infra := &actions.Repo{Name: "foo/infra", SSHURL: "git@github.com:foo/infra.git"}
+	repoList := actions.Repos{
+		docs,
+		infra,
+		{Name: "foo/api", SSHURL: "git@github.com:foo/api.git"},
+	}
+
+	managed, moves := layoutDirs(dir, repoList, []string{"bar/docs", "docs", "foo/api", "foo/gone", "infra", "other"})
+
+	// bar is another owner, infra was cloned from another repo and other
+	// isn't in the list so they are all left alone
+	assert.Equal(t, []string{"foo/docs", "foo/api", "foo/gone"}, managed)
+	assert.Equal(t, actions.Repos{docs}, moves)
+	assert.Equal(t, "docs", docs.OldName)
+	assert.Equal(t, "", infra.OldName)
+}
+
+// initRepo creates an empty git repo at dir
+func initRepo(t *testing.T, dir string) {
+	t.Helper()
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runGit(t, dir, "init", "-q")
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %s", args, output)
+	}
+}
@@ -2,7 +2,9 @@ package cli
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/lhopki01/git-mass-sync/actions"
 	"github.com/mitchellh/colorstring"
@@ -13,90 +15,71 @@ import (
 var localCmd = &cobra.Command{
 	Use:   "local [target dir]",
 	Short: "Sync all repos within the target directory",
+	Example: `To sync every repo up to 3 dirs deep in ~/src apart from those in scratch dirs
+> git-mass-sync local ~/src --max-depth 3 --ignore scratch`,
 	//nolint:gomnd
-	Args: cobra.ExactArgs(1),
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{targetDirArg: "0"},
 	Run: func(cmd *cobra.Command, args []string) {
-		runLocal(args)
+		os.Exit(runLocal(args))
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(localCmd)
+
+	localCmd.Flags().Int("max-depth", 0, "How many dirs deep to look for git repos\n(default is as deep as --layout needs, 1 for flat)")
+	localCmd.Flags().StringSlice("ignore", nil, "Globs matched against the path and name of dirs to not look for git repos in")
 }
 
-func runLocal(args []string) {
+func runLocal(args []string) int {
+	started := time.Now()
 	dir := filepath.Clean(args[0])
 
-	fmt.Println("=============")
-	fmt.Printf("Syncing all git repos in %s", dir)
-	fmt.Println("=============")
+	fmt.Fprintln(out, "=============")
+	fmt.Fprintf(out, "Syncing all git repos in %s", dir)
+	fmt.Fprintln(out, "=============")
 
-	var reposToSync actions.Repos
-	for _, dir := range actions.GetGitDirList(dir) {
-		reposToSync = append(reposToSync, &actions.Repo{
-			Name: dir,
-		})
+	reposToSync, err := localRepos(dir)
+	if err != nil {
+		colorstring.Fprintf(out, "[red]Unable to read %s: %s\n", dir, err)
+		return exitError
 	}
 
-	lenSync := len(reposToSync)
+	fmt.Fprintln(out, "=============")
+	colorstring.Fprintf(out, "[green]%d repos to sync\n", len(reposToSync))
+	fmt.Fprintln(out, "=============")
 
-	fmt.Println("=============")
-	colorstring.Printf("[green]%d repos to sync\n", lenSync)
-	fmt.Println("=============")
+	ctx, cancel := interruptContext()
+	defer cancel()
 
-	reposToSync.SyncRepos(dir)
+	reposToSync.SyncRepos(ctx, dir)
 
-	lenSyncWarnings := 0
-	warnings := false
+	return reportResults(ctx, dir, "", started, resultGroup{action: "Sync", done: "synced", color: "green", repos: reposToSync})
+}
 
-	for _, repo := range reposToSync {
-		if repo.Severity == actions.Warning {
-			if !warnings {
-				fmt.Println("=============")
-				//nolint:errcheck
-				colorstring.Println("[yellow]Warnings:")
+// localRepos returns every git repo in dir up to --max-depth dirs deep
+func localRepos(dir string) (actions.Repos, error) {
+	var dirList []string
 
-				warnings = true
-			}
+	var err error
 
-			colorstring.Printf("[green]Sync %s: [yellow]%s", repo.Name, repo.Message)
-			lenSyncWarnings++
-		}
+	if depth := viper.GetInt("max-depth"); depth > 0 {
+		dirList, err = actions.FindGitDirs(dir, depth)
+	} else {
+		dirList, err = actions.GetGitDirList(dir)
 	}
-	// No warnings from clone or archive
-	if warnings {
-		fmt.Println("=============")
-	}
-
-	lenSyncFailures := 0
-	errors := false
 
-	for _, repo := range reposToSync {
-		if repo.Severity == actions.Error {
-			if !errors {
-				fmt.Println("=============")
-				//nolint:errcheck
-				colorstring.Println("[red]Errors:")
-
-				errors = true
-			}
-
-			colorstring.Printf("[green]Sync %s: [red]%s", repo.Name, repo.Message)
-			lenSyncFailures++
-		}
+	if err != nil {
+		return nil, err
 	}
 
-	if errors {
-		fmt.Println("=============")
+	var repos actions.Repos
+	for _, name := range dirList {
+		repos = append(repos, &actions.Repo{
+			Name: name,
+		})
 	}
 
-	if !viper.GetBool("dry-run") {
-		fmt.Println("=============")
-
-		if lenSyncFailures > 0 {
-			colorstring.Printf("[red]%d[reset]/[green]%d repos synced\n", lenSync-lenSyncFailures, lenSync)
-		} else {
-			colorstring.Printf("[green]%d/%d repos synced\n", lenSync-lenSyncFailures, lenSync)
-		}
-	}
+	return repos, nil
 }
@@ -0,0 +1,364 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/mitchellh/colorstring"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Types of manifest source
+const (
+	sourceGithub = "github"
+	sourceGitlab = "gitlab"
+	sourceLocal  = "local"
+)
+
+var syncAllCmd = &cobra.Command{
+	Use:   "sync-all [manifest]",
+	Short: "Sync every source listed in a manifest",
+	Long: `Sync every source listed in a YAML or TOML manifest and print a combined summary.
+Each source is a github org or user, a gitlab group or a local directory with its own
+download dir and optionally its own search, include, exclude, archive-dir, strategy and layout.`,
+	Example: `> cat workspace.yaml
+sources:
+  - type: github
+    id: foobar
+    dir: ~/src/foobar
+    search: "archived:false"
+    strategy: rebase
+  - type: gitlab
+    id: foobar/infra
+    dir: ~/src/infra
+    exclude: "-old$"
+  - type: local
+    dir: ~/src/misc
+> git-mass-sync sync-all workspace.yaml`,
+	//nolint:gomnd
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(runSyncAll(args[0]))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncAllCmd)
+
+	addArchiveFormatFlag(syncAllCmd)
+	addCloneFlags(syncAllCmd)
+	addSafetyFlags(syncAllCmd)
+}
+
+// manifestSource is one set of repos to sync into a directory
+type manifestSource struct {
+	Type       string `mapstructure:"type"`
+	ID         string `mapstructure:"id"`
+	Dir        string `mapstructure:"dir"`
+	ArchiveDir string `mapstructure:"archive-dir"`
+	Search     string `mapstructure:"search"`
+	Include    string `mapstructure:"include"`
+	Exclude    string `mapstructure:"exclude"`
+	Strategy   string `mapstructure:"strategy"`
+	Layout     string `mapstructure:"layout"`
+	MaxDepth   int    `mapstructure:"max-depth"`
+	GithubURL  string `mapstructure:"github-url"`
+	GitlabURL  string `mapstructure:"gitlab-url"`
+}
+
+// loadManifest reads the sources from the manifest at path
+func loadManifest(path string) ([]manifestSource, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+
+	err := v.ReadInConfig()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read manifest %s", path)
+	}
+
+	var sources []manifestSource
+
+	err = v.UnmarshalKey("sources", &sources)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse manifest %s", path)
+	}
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("manifest %s has no sources", path)
+	}
+
+	for i := range sources {
+		err = sources[i].validate()
+		if err != nil {
+			return nil, fmt.Errorf("manifest %s source %d: %s", path, i+1, err)
+		}
+	}
+
+	return sources, nil
+}
+
+func (s *manifestSource) validate() error {
+	switch s.Type {
+	case sourceGithub, sourceGitlab:
+		if s.ID == "" {
+			return fmt.Errorf("%s sources need an id", s.Type)
+		}
+
+		if s.MaxDepth != 0 {
+			return fmt.Errorf("only local sources support max-depth")
+		}
+	case sourceLocal:
+		if s.ID != "" || s.Search != "" || s.Include != "" || s.Exclude != "" || s.ArchiveDir != "" {
+			return fmt.Errorf("local sources only support dir, strategy, layout and max-depth")
+		}
+	default:
+		return fmt.Errorf("unknown type [%s], must be one of [%s %s %s]", s.Type, sourceGithub, sourceGitlab, sourceLocal)
+	}
+
+	if s.Dir == "" {
+		return fmt.Errorf("%s sources need a dir", s.Type)
+	}
+
+	if s.Search != "" && s.Type != sourceGithub {
+		return fmt.Errorf("%s: search is only supported for github sources", s)
+	}
+
+	if s.Strategy != "" {
+		_, err := actions.ParseStrategy(s.Strategy)
+		if err != nil {
+			return fmt.Errorf("%s: %s", s, err)
+		}
+	}
+
+	if s.Layout != "" {
+		_, err := actions.ParseLayout(s.Layout)
+		if err != nil {
+			return fmt.Errorf("%s: %s", s, err)
+		}
+	}
+
+	for _, r := range []string{s.Include, s.Exclude} {
+		_, err := regexp.Compile(r)
+		if err != nil {
+			return fmt.Errorf("%s: %s", s, err)
+		}
+	}
+
+	s.Dir = expandHome(s.Dir)
+	s.ArchiveDir = expandHome(s.ArchiveDir)
+
+	return nil
+}
+
+func (s manifestSource) String() string {
+	if s.Type == sourceLocal {
+		return fmt.Sprintf("local %s", s.Dir)
+	}
+
+	return fmt.Sprintf("%s %s", s.Type, s.ID)
+}
+
+// apply sets the flags used by the sync to the settings of the source,
+// falling back to their defaults and the strategy and layout of the run.
+func (s manifestSource) apply(strategy, layout string) {
+	settings := map[string]string{
+		"search":      s.Search,
+		"include":     s.Include,
+		"exclude":     s.Exclude,
+		"archive-dir": s.ArchiveDir,
+		"strategy":    s.Strategy,
+		"layout":      s.Layout,
+	}
+	defaults := map[string]string{
+		"include":  ".*",
+		"exclude":  "^$",
+		"strategy": strategy,
+		"layout":   layout,
+	}
+
+	for key, value := range settings {
+		if value == "" {
+			value = defaults[key]
+		}
+
+		viper.Set(key, value)
+	}
+
+	viper.Set("max-depth", s.MaxDepth)
+}
+
+func (s manifestSource) provider() Provider {
+	if s.Type == sourceGitlab {
+		gitlabURL := s.GitlabURL
+		if gitlabURL == "" {
+			gitlabURL = defaultGitlabURL
+		}
+
+		return gitlabProvider{client: http.DefaultClient, baseURL: gitlabURL}
+	}
+
+	githubURL := s.GithubURL
+	if githubURL == "" {
+		githubURL = os.Getenv("GITHUB_GMS_URL")
+	}
+
+	return githubProvider{baseURL: githubURL}
+}
+
+// plan works out the actions for the source, returning a non zero exit code
+// if it can't.
+func (s manifestSource) plan() (*syncPlan, int) {
+	if s.Type == sourceLocal {
+		dir := filepath.Clean(s.Dir)
+
+		fmt.Fprintln(out, "=============")
+		fmt.Fprintf(out, "Syncing all git repos in %s\n", dir)
+		fmt.Fprintln(out, "=============")
+
+		repos, err := localRepos(dir)
+		if err != nil {
+			colorstring.Fprintf(out, "[red]Unable to read %s: %s\n", dir, err)
+			return nil, exitError
+		}
+
+		return &syncPlan{dir: dir, sync: repos}, exitOK
+	}
+
+	p := s.provider()
+	dir, archiveDir, id, inR, exR := processFlags([]string{s.ID, s.Dir})
+
+	repoList, err := listRepos(p, id)
+	if err != nil {
+		colorstring.Fprintf(out, "[red]Failed to get repo list for %s: %s\n", s, err)
+		return nil, exitListing
+	}
+
+	plan, err := newSyncPlan(p, id, repoList, dir, archiveDir, inR, exR)
+	if err != nil {
+		if _, ok := err.(archiveLimitError); ok {
+			colorstring.Fprintf(out, "[red]Refusing to archive for %s: %s\nRerun with --force if this is expected\n", s, err)
+			return nil, exitAborted
+		}
+
+		colorstring.Fprintf(out, "[red]Unable to plan %s: %s\n", s, err)
+
+		return nil, exitError
+	}
+
+	return plan, exitOK
+}
+
+// runSyncAll syncs every source in the manifest at path one after another and
+// reports the results together. Sources that can't be listed or would
+// archive too much are skipped and decide the exit code unless something
+// worse happens.
+func runSyncAll(path string) int {
+	started := time.Now()
+
+	sources, err := loadManifest(path)
+	if err != nil {
+		colorstring.Fprintf(out, "[red]%s\n", err)
+		return exitError
+	}
+
+	strategy := viper.GetString("strategy")
+	layout := viper.GetString("layout")
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	var plans []*syncPlan
+
+	code := exitOK
+
+	for _, s := range sources {
+		if ctx.Err() != nil {
+			break
+		}
+
+		s.apply(strategy, layout)
+
+		plan, planCode := s.plan()
+		if planCode != exitOK {
+			if code == exitOK {
+				code = planCode
+			}
+
+			continue
+		}
+
+		plan.printCounts()
+
+		err := plan.run(ctx)
+		if err != nil {
+			colorstring.Fprintf(out, "[red]%s: %s\n", s, err)
+
+			if code == exitOK {
+				code = exitError
+			}
+		}
+
+		plans = append(plans, plan)
+	}
+
+	result := reportResults(ctx, "", "", started, combineGroups(plans)...)
+	if code != exitOK && (result == exitOK || result == exitWarning) {
+		return code
+	}
+
+	return result
+}
+
+// combineGroups merges the result groups of several plans so they can be
+// reported together. Repos are copied with their dir prepended to their name
+// so repos with the same name in different dirs can be told apart.
+func combineGroups(plans []*syncPlan) []resultGroup {
+	var combined []resultGroup
+
+	for _, plan := range plans {
+		copies := map[*actions.Repo]*actions.Repo{}
+
+		for i, g := range plan.groups() {
+			if i == len(combined) {
+				combined = append(combined, g)
+				combined[i].repos = actions.Repos{}
+			}
+
+			for _, repo := range g.repos {
+				c, ok := copies[repo]
+				if !ok {
+					r := *repo
+					r.Name = filepath.Join(plan.dir, repo.Name)
+					c = &r
+					copies[repo] = c
+				}
+
+				combined[i].repos = append(combined[i].repos, c)
+			}
+		}
+	}
+
+	return combined
+}
+
+// expandHome replaces a leading ~ in path with the home dir
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	home, err := os.UserHomeDir()
+	assert.NoError(t, err)
+
+	path := dir + "/workspace.yaml"
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`
+sources:
+  - type: github
+    id: foobar
+    dir: ~/src/foobar
+    search: "archived:false"
+    strategy: rebase
+  - type: gitlab
+    id: foobar/infra
+    dir: /src/infra
+    archive-dir: /src/.archive/infra
+    exclude: "-old$"
+    gitlab-url: https://gitlab.example.com
+  - type: local
+    dir: /src/misc
+`), 0644))
+
+	sources, err := loadManifest(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []manifestSource{
+		{Type: "github", ID: "foobar", Dir: filepath.Join(home, "src/foobar"), Search: "archived:false", Strategy: "rebase"},
+		{Type: "gitlab", ID: "foobar/infra", Dir: "/src/infra", ArchiveDir: "/src/.archive/infra", Exclude: "-old$", GitlabURL: "https://gitlab.example.com"},
+		{Type: "local", Dir: "/src/misc"},
+	}, sources)
+}
+
+func TestLoadManifestInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		manifest string
+		err      string
+	}{
+		"noSources":   {"foo: bar", "has no sources"},
+		"unknownType": {"sources: [{type: bitbucket, id: foo, dir: /src}]", "source 1: unknown type [bitbucket], must be one of [github gitlab local]"},
+		"noID":        {"sources: [{type: github, dir: /src}]", "source 1: github sources need an id"},
+		"noDir":       {"sources: [{type: local}]", "source 1: local sources need a dir"},
+		"localID":     {"sources: [{type: local, id: foo, dir: /src}]", "source 1: local sources only support dir, strategy, layout and max-depth"},
+		"search":      {"sources: [{type: gitlab, id: foo, dir: /src, search: topic:foo}]", "source 1: gitlab foo: search is only supported for github sources"},
+		"strategy":    {"sources: [{type: github, id: foo, dir: /src, strategy: merge}]", "source 1: github foo: unknown sync strategy [merge]"},
+		"maxDepth":    {"sources: [{type: github, id: foo, dir: /src, max-depth: 2}]", "source 1: only local sources support max-depth"},
+		"layout":      {"sources: [{type: github, id: foo, dir: /src, layout: nested}]", "source 1: github foo: unknown layout [nested]"},
+		"regex":       {"sources: [{type: github, id: foo, dir: /src}, {type: github, id: bar, dir: /src, include: '('}]", "source 2: github bar: error parsing regexp"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := dir + "/" + name + ".yaml"
+			assert.NoError(t, ioutil.WriteFile(path, []byte(tt.manifest), 0644))
+
+			_, err := loadManifest(path)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestManifestSourceApply(t *testing.T) {
+	defer manifestSource{}.apply("", "flat")
+
+	manifestSource{Include: "^api-", Strategy: "reset", Layout: "owner/name"}.apply("rebase", "flat")
+	assert.Equal(t, "^api-", viper.GetString("include"))
+	assert.Equal(t, "^$", viper.GetString("exclude"))
+	assert.Equal(t, "reset", viper.GetString("strategy"))
+	assert.Equal(t, "owner/name", viper.GetString("layout"))
+
+	// Settings from the previous source must not leak into the next
+	manifestSource{}.apply("rebase", "flat")
+	assert.Equal(t, ".*", viper.GetString("include"))
+	assert.Equal(t, "rebase", viper.GetString("strategy"))
+	assert.Equal(t, "flat", viper.GetString("layout"))
+}
+
+func TestCombineGroups(t *testing.T) {
+	cloneArchiveRepo := &actions.Repo{Name: "cloneArchiveRepo", Archived: true, Reason: actions.ReasonArchived}
+	plans := []*syncPlan{
+		{
+			dir:     "/src/foo",
+			sync:    actions.Repos{{Name: "api"}},
+			clone:   actions.Repos{cloneArchiveRepo},
+			archive: actions.Repos{cloneArchiveRepo, {Name: "deletedRepo", Reason: actions.ReasonDeleted}},
+		},
+		{
+			dir:  "/src/bar",
+			sync: actions.Repos{{Name: "api", Severity: actions.Error}},
+		},
+	}
+
+	groups := combineGroups(plans)
+	assert.Len(t, groups, 7)
+	assert.Equal(t, actions.Repos{}, groups[0].repos)
+	assert.Equal(t, actions.Repos{}, groups[1].repos)
+	assert.Equal(t, actions.Repos{{Name: "/src/foo/api"}, {Name: "/src/bar/api", Severity: actions.Error}}, groups[2].repos)
+	assert.Equal(t, actions.Repos{{Name: "/src/foo/cloneArchiveRepo", Archived: true, Reason: actions.ReasonArchived}}, groups[3].repos)
+	assert.True(t, groups[3].repos[0] == groups[4].repos[0])
+	assert.Equal(t, actions.Repos{{Name: "/src/foo/deletedRepo", Reason: actions.ReasonDeleted}}, groups[5].repos)
+	assert.Equal(t, actions.Repos{}, groups[6].repos)
+	// The plans are left untouched
+	assert.Equal(t, "api", plans[0].sync[0].Name)
+}
@@ -0,0 +1,627 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/mitchellh/colorstring"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	planVersion     = 2
+	defaultPlanFile = "git-mass-sync.plan.json"
+	// maxDriftShown limits how many drifted repos are listed when refusing to apply
+	maxDriftShown = 10
+)
+
+// Actions as written in a plan file
+const (
+	planMove      = "move"
+	planUnarchive = "unarchive"
+	planSync      = "sync"
+	planClone     = "clone"
+	planArchive   = "archive"
+	planKeep      = "keep"
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Save the actions a sync would take to a file to be applied later",
+	Example: `To review what syncing org foobar would do before applying it
+> git-mass-sync plan github foobar ~/download/dir --plan-file foobar.plan.json
+> git-mass-sync apply foobar.plan.json`,
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply [plan file]",
+	Short: "Run exactly the actions in a plan file",
+	Long: `Run exactly the actions in a plan file created by the plan command.
+Refuses to run if the git repos in the download dir have changed since the plan was made.`,
+	//nolint:gomnd
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{planFileArg: "0"},
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(runApply(args[0]))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(applyCmd)
+
+	for _, cmd := range []*cobra.Command{newGithubCmd(runPlan), newGitlabCmd(runPlan)} {
+		cmd.Example = ""
+		planCmd.AddCommand(cmd)
+	}
+
+	planCmd.PersistentFlags().String("plan-file", defaultPlanFile, "File to save the plan to")
+}
+
+// planSettings are the settings that change what applying a plan does. They
+// are saved with the plan and used instead of those set when applying it.
+var planSettings = []string{
+	"layout",
+	"strategy",
+	"protocol",
+	"archive-format",
+	// Mirrors are named name.git and never checked for unsaved work
+	"mirror",
+	// Clone options, including those set per repo in the config files
+	"depth",
+	"filter",
+	"single-branch",
+	"sparse",
+	"repos",
+}
+
+// syncPlan is the set of actions needed to make a download dir match the
+// remote repo list
+type syncPlan struct {
+	dir        string
+	archiveDir string
+	// dirs are the git repos that were in dir when planning
+	dirs []string
+	// move are repos that are moved within dir before anything else
+	move actions.Repos
+	// unarchive are repos moved back from the archive dir before syncing
+	unarchive actions.Repos
+	sync      actions.Repos
+	clone     actions.Repos
+	archive   actions.Repos
+	// keep are repos that would have been archived but still exist upstream
+	keep actions.Repos
+	// provider is the name of the provider the repos were listed from, which
+	// is saved so the credentials can be read again when applying the plan
+	provider string
+	// credentials are used with --protocol https. Only their host is saved
+	// with the plan.
+	credentials actions.Credentials
+	// settings are the values of planSettings when planning
+	settings map[string]interface{}
+}
+
+// planFile is how a syncPlan is saved to disk
+type planFile struct {
+	Version    int                    `json:"version"`
+	CreatedAt  time.Time              `json:"created_at"`
+	Dir        string                 `json:"dir"`
+	ArchiveDir string                 `json:"archive_dir"`
+	Provider   string                 `json:"provider,omitempty"`
+	Host       string                 `json:"host,omitempty"`
+	Settings   map[string]interface{} `json:"settings,omitempty"`
+	Dirs       []string               `json:"dirs"`
+	Repos      []plannedRepo          `json:"repos"`
+}
+
+type plannedRepo struct {
+	Action string `json:"action"`
+	*actions.Repo
+}
+
+// newSyncPlan works out the actions needed to make dir match repoList. It
+// returns an error if the plan would archive more repos than allowed.
+func newSyncPlan(
+	p Provider,
+	id string,
+	repoList actions.Repos,
+	dir, archiveDir string,
+	inR, exR *regexp.Regexp,
+) (*syncPlan, error) {
+	dirList, err := actions.GetGitDirList(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read %s", dir)
+	}
+
+	plan := &syncPlan{
+		dir:        dir,
+		archiveDir: archiveDir,
+		provider:   providerName(p),
+		settings:   currentSettings(),
+		// repoActions reorders dirList
+		dirs: append([]string(nil), dirList...),
+	}
+
+	layout := actions.Layout(viper.GetString("layout"))
+	repoList.ApplyLayout(layout)
+
+	if layout != actions.LayoutFlat {
+		dirList, plan.move = layoutDirs(dir, repoList, dirList)
+	}
+
+	lenDirs := len(dirList)
+
+	plan.sync, plan.clone, plan.archive = repoActions(repoList, dirList, archiveDir, inR, exR)
+
+	if c, ok := p.(CredentialProvider); ok {
+		plan.credentials = c.Credentials()
+	}
+
+	var getter RepoGetter
+	if g, ok := p.(RepoGetter); ok {
+		getter = newCachedGetter(g)
+	}
+
+	var renamed actions.Repos
+
+	plan.clone, plan.archive, renamed, plan.keep = detectRenames(dir, getter, id, plan.clone, plan.archive)
+
+	for _, repo := range renamed {
+		plan.move = append(plan.move, repo)
+
+		// Archived repos are already in the archive list
+		if !repo.Archived {
+			plan.sync = append(plan.sync, repo)
+		}
+	}
+
+	plan.clone, plan.unarchive = restoreArchived(archiveDir, plan.clone)
+	plan.sync = append(plan.sync, plan.unarchive...)
+
+	if getter != nil {
+		var keep actions.Repos
+
+		plan.archive, keep = confirmDeleted(getter, dir, id, plan.archive)
+		plan.keep = append(plan.keep, keep...)
+	}
+
+	// Moves are reported separately from the sync that follows them
+	plan.move = copyRepos(plan.move)
+	plan.unarchive = copyRepos(plan.unarchive)
+
+	err = checkArchiveLimits(plan.archive, plan.clone, lenDirs)
+	if err != nil && !viper.GetBool("force") {
+		return nil, archiveLimitError{err}
+	}
+
+	return plan, nil
+}
+
+// currentSettings returns the values of planSettings that are set
+func currentSettings() map[string]interface{} {
+	settings := map[string]interface{}{}
+
+	for _, key := range planSettings {
+		if value := viper.Get(key); value != nil {
+			settings[key] = value
+		}
+	}
+
+	return settings
+}
+
+// planFailed prints why a plan couldn't be made and returns the exit code
+func planFailed(err error) int {
+	if _, ok := err.(archiveLimitError); ok {
+		colorstring.Fprintf(out, "[red]Refusing to archive: %s\nRerun with --force if this is expected\n", err)
+		return exitAborted
+	}
+
+	colorstring.Fprintf(out, "[red]%s\n", err)
+
+	return exitError
+}
+
+func (plan *syncPlan) printCounts() {
+	fmt.Fprintln(out, "=============")
+
+	if len(plan.move) > 0 {
+		colorstring.Fprintf(out, "[blue]%d repos to move\n", len(plan.move))
+	}
+
+	if len(plan.unarchive) > 0 {
+		colorstring.Fprintf(out, "[light_blue]%d repos to unarchive\n", len(plan.unarchive))
+	}
+
+	colorstring.Fprintf(out, "[green]%d repos to sync\n", len(plan.sync))
+	colorstring.Fprintf(out, "[cyan]%d repos to clone\n", len(plan.clone))
+	colorstring.Fprintf(out, "[light_magenta]%d repos to archive as archived upstream\n", len(plan.archived()))
+	colorstring.Fprintf(out, "[light_magenta]%d repos to archive as deleted upstream\n", len(plan.deleted()))
+	fmt.Fprintln(out, "=============")
+}
+
+// printActions lists the repos that will be cloned or archived. Synced repos
+// are left out as there are usually far too many to review.
+func (plan *syncPlan) printActions() {
+	for _, repo := range plan.move {
+		colorstring.Fprintf(out, "[blue]Will move %s to %s\n", repo.OldName, repo.Name)
+	}
+
+	for _, repo := range plan.unarchive {
+		colorstring.Fprintf(out, "[light_blue]Will unarchive %s from %s\n", repo.Name, plan.archiveDir)
+	}
+
+	for _, repo := range plan.clone {
+		colorstring.Fprintf(out, "[cyan]Will clone %s\n", repo.Name)
+	}
+
+	for _, repo := range plan.archive {
+		colorstring.Fprintf(out, "[light_magenta]Will archive %s (%s) in %s\n", repo.Name, repo.Reason, plan.archiveDir)
+	}
+
+	for _, repo := range plan.keep {
+		colorstring.Fprintf(out, "[yellow]Will keep %s: %s\n", repo.Name, repo.Message)
+	}
+}
+
+// execute runs the plan and reports the results, returning the exit code
+func (plan *syncPlan) execute() int {
+	started := time.Now()
+
+	plan.printCounts()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	err := plan.run(ctx)
+	if err != nil {
+		colorstring.Fprintf(out, "[red]%s\n", err)
+	}
+
+	code := reportResults(ctx, plan.dir, plan.archiveDir, started, plan.groups()...)
+	if err != nil && (code == exitOK || code == exitWarning) {
+		return exitError
+	}
+
+	return code
+}
+
+// run carries out the actions in the plan. It returns an error if some of them
+// couldn't be started at all.
+func (plan *syncPlan) run(ctx context.Context) error {
+	// Order is very important here.  Move and unarchive must come first and
+	// clone must always come before archive
+	actions.SetCredentials(plan.credentials)
+
+	plan.move.MoveRepos(ctx, plan.dir)
+	plan.unarchive.UnarchiveRepos(ctx, plan.dir, plan.archiveDir)
+
+	// Repos that couldn't be moved into place can't be synced or archived
+	failed := map[string]bool{}
+	for _, repo := range append(plan.move, plan.unarchive...) {
+		if repo.Severity == actions.Error {
+			failed[repo.Name] = true
+		}
+	}
+
+	plan.sync = withoutNames(plan.sync, failed)
+	plan.archive = withoutNames(plan.archive, failed)
+
+	plan.sync.SyncRepos(ctx, plan.dir)
+	plan.clone.CloneRepos(ctx, plan.dir)
+
+	// Plans for local dirs only sync
+	if plan.archiveDir != "" {
+		return plan.archive.ArchiveRepos(ctx, plan.dir, plan.archiveDir)
+	}
+
+	return nil
+}
+
+// groups returns the repos in the plan grouped by action for reporting
+func (plan *syncPlan) groups() []resultGroup {
+	return []resultGroup{
+		{action: "Move", done: "moved", color: "blue", repos: plan.move},
+		{action: "Unarchive", done: "unarchived", color: "light_blue", repos: plan.unarchive},
+		{action: "Sync", done: "synced", color: "green", repos: plan.sync},
+		{action: "Clone", done: "cloned", color: "cyan", repos: plan.clone},
+		{action: "Archive", done: "archived as archived upstream", color: "light_magenta", repos: plan.archived(), warningSkips: true},
+		{action: "Archive", done: "archived as deleted upstream", color: "magenta", repos: plan.deleted(), warningSkips: true},
+		{action: "Archive", color: "light_magenta", repos: plan.keep, warningSkips: true},
+	}
+}
+
+// archived returns the repos to archive because they were archived upstream
+func (plan *syncPlan) archived() actions.Repos {
+	var archived actions.Repos
+
+	for _, repo := range plan.archive {
+		if repo.Reason != actions.ReasonDeleted {
+			archived = append(archived, repo)
+		}
+	}
+
+	return archived
+}
+
+// deleted returns the repos to archive because they were deleted upstream
+func (plan *syncPlan) deleted() actions.Repos {
+	var deleted actions.Repos
+
+	for _, repo := range plan.archive {
+		if repo.Reason == actions.ReasonDeleted {
+			deleted = append(deleted, repo)
+		}
+	}
+
+	return deleted
+}
+
+// copyRepos returns copies of repos so their results are kept apart from
+// the results of the originals
+func copyRepos(repos actions.Repos) actions.Repos {
+	var copies actions.Repos
+
+	for _, repo := range repos {
+		c := *repo
+		copies = append(copies, &c)
+	}
+
+	return copies
+}
+
+// withoutNames returns repos without those named in names
+func withoutNames(repos actions.Repos, names map[string]bool) actions.Repos {
+	var kept actions.Repos
+
+	for _, repo := range repos {
+		if !names[repo.Name] {
+			kept = append(kept, repo)
+		}
+	}
+
+	return kept
+}
+
+// planList is one of the lists of repos in a plan and its action
+type planList struct {
+	action string
+	repos  *actions.Repos
+}
+
+// lists returns the lists of repos in the plan in the order they are saved
+func (plan *syncPlan) lists() []planList {
+	return []planList{
+		{planMove, &plan.move},
+		{planUnarchive, &plan.unarchive},
+		{planSync, &plan.sync},
+		{planClone, &plan.clone},
+		{planArchive, &plan.archive},
+		{planKeep, &plan.keep},
+	}
+}
+
+func (plan *syncPlan) save(path string) error {
+	f := planFile{
+		Version:    planVersion,
+		CreatedAt:  time.Now(),
+		Dir:        plan.dir,
+		ArchiveDir: plan.archiveDir,
+		Provider:   plan.provider,
+		Host:       plan.credentials.Host,
+		Settings:   plan.settings,
+		Dirs:       plan.dirs,
+		Repos:      []plannedRepo{},
+	}
+
+	// Repos with more than one action, such as those cloned straight into
+	// the archive, have their actions joined with a "+"
+	index := map[*actions.Repo]int{}
+
+	for _, l := range plan.lists() {
+		for _, repo := range *l.repos {
+			if i, ok := index[repo]; ok {
+				f.Repos[i].Action += "+" + l.action
+				continue
+			}
+
+			index[repo] = len(f.Repos)
+			f.Repos = append(f.Repos, plannedRepo{Action: l.action, Repo: repo})
+		}
+	}
+
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to create plan")
+	}
+
+	return ioutil.WriteFile(path, append(b, '\n'), 0644) //nolint:gosec
+}
+
+func loadPlan(path string) (*syncPlan, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read plan")
+	}
+
+	var f planFile
+
+	err = json.Unmarshal(b, &f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse plan %s", path)
+	}
+
+	if f.Version != planVersion {
+		return nil, fmt.Errorf("plan %s has version %d but only version %d is supported", path, f.Version, planVersion)
+	}
+
+	plan := &syncPlan{
+		dir:        f.Dir,
+		archiveDir: f.ArchiveDir,
+		provider:   f.Provider,
+		dirs:       f.Dirs,
+		settings:   map[string]interface{}{},
+	}
+
+	// The plan is applied with the settings it was made with, whatever the
+	// flags and config files say now
+	viper.Set("archive-dir", f.ArchiveDir)
+
+	for _, key := range planSettings {
+		if value, ok := f.Settings[key]; ok {
+			plan.settings[key] = value
+			viper.Set(key, value)
+		}
+	}
+
+	err = checkSettings()
+	if err != nil {
+		return nil, errors.Wrapf(err, "plan %s has invalid settings", path)
+	}
+
+	// Tokens aren't saved in plans so are read from the env again
+	if f.Provider != "" {
+		if c, ok := (manifestSource{Type: f.Provider}).provider().(CredentialProvider); ok {
+			plan.credentials = c.Credentials()
+			plan.credentials.Host = f.Host
+		}
+	}
+
+	lists := map[string]*actions.Repos{}
+	for _, l := range plan.lists() {
+		lists[l.action] = l.repos
+	}
+
+	for _, pr := range f.Repos {
+		for _, action := range strings.Split(pr.Action, "+") {
+			repos, ok := lists[action]
+			if !ok {
+				return nil, fmt.Errorf("plan %s has unknown action [%s] for %s", path, pr.Action, pr.Name)
+			}
+
+			if action == planKeep {
+				pr.Repo.Severity = actions.Warning
+			}
+
+			*repos = append(*repos, pr.Repo)
+		}
+	}
+
+	return plan, nil
+}
+
+// planDir returns the download dir of the plan file at path, or "" if it
+// can't be read, which is reported when the plan is loaded
+func planDir(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	var f planFile
+	if json.Unmarshal(b, &f) != nil {
+		return ""
+	}
+
+	return f.Dir
+}
+
+// checkDrift returns an error if the git repos in the download dir are not
+// the ones that were there when the plan was made.
+func (plan *syncPlan) checkDrift() error {
+	dirs, err := actions.GetGitDirList(plan.dir)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read %s", plan.dir)
+	}
+
+	current := map[string]bool{}
+	for _, dir := range dirs {
+		current[dir] = true
+	}
+
+	var drift []string
+
+	for _, dir := range plan.dirs {
+		if !current[dir] {
+			drift = append(drift, fmt.Sprintf("%s has been removed", dir))
+		}
+
+		delete(current, dir)
+	}
+
+	for dir := range current {
+		drift = append(drift, fmt.Sprintf("%s has been added", dir))
+	}
+
+	if len(drift) == 0 {
+		return nil
+	}
+
+	sort.Strings(drift)
+
+	if len(drift) > maxDriftShown {
+		drift = append(drift[:maxDriftShown], fmt.Sprintf("and %d more", len(drift)-maxDriftShown))
+	}
+
+	return fmt.Errorf("%s has changed since the plan was made:\n  %s", plan.dir, strings.Join(drift, "\n  "))
+}
+
+// runPlan saves the plan for syncing the download dir with the repos listed
+// by p instead of running it.
+func runPlan(p Provider, args []string) {
+	dir, archiveDir, id, inR, exR := processFlags(args)
+
+	repoList, err := listRepos(p, id)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitListing)
+	}
+
+	plan, err := newSyncPlan(p, id, repoList, dir, archiveDir, inR, exR)
+	if err != nil {
+		os.Exit(planFailed(err))
+	}
+
+	plan.printActions()
+	plan.printCounts()
+
+	planPath := viper.GetString("plan-file")
+
+	err = plan.save(planPath)
+	if err != nil {
+		colorstring.Fprintf(out, "[red]Failed to save plan: %s\n", err)
+		os.Exit(exitError)
+	}
+
+	fmt.Fprintf(out, "Plan saved to %s\n", planPath)
+}
+
+func runApply(path string) int {
+	plan, err := loadPlan(path)
+	if err != nil {
+		colorstring.Fprintf(out, "[red]%s\n", err)
+		return exitError
+	}
+
+	fmt.Fprintln(out, "=============")
+	fmt.Fprintf(out, "Applying plan %s to %s\n", path, plan.dir)
+	fmt.Fprintln(out, "=============")
+
+	err = plan.checkDrift()
+	if err != nil {
+		colorstring.Fprintf(out, "[red]Refusing to apply plan: %s\nCreate a new plan\n", err)
+		return exitAborted
+	}
+
+	return plan.execute()
+}
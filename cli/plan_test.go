@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cloneArchiveRepo := &actions.Repo{Name: "cloneArchiveRepo", SSHURL: "git@github.com:foo/cloneArchiveRepo.git", Archived: true}
+	moveRepo := &actions.Repo{Name: "foo/moveRepo", OldName: "moveRepo", Owner: "foo"}
+	os.Setenv("GITLAB_GMS_TOKEN", "secret")
+	defer os.Unsetenv("GITLAB_GMS_TOKEN")
+
+	for key, value := range map[string]string{"layout": "owner/name", "strategy": "rebase", "protocol": "https", "archive-format": "tar.gz"} {
+		viper.Set(key, value)
+		defer viper.Set(key, "")
+	}
+
+	viper.Set("mirror", true)
+	defer viper.Set("mirror", false)
+	viper.Set("depth", 1)
+	defer viper.Set("depth", 0)
+	viper.Set("sparse", []string{"docs"})
+	defer viper.Set("sparse", nil)
+	viper.Set("repos", map[string]interface{}{"big": map[string]interface{}{"filter": "blob:none"}})
+	defer viper.Set("repos", nil)
+	defer viper.Set("archive-dir", "")
+
+	plan := &syncPlan{
+		dir:         dir,
+		archiveDir:  dir + "/.archive",
+		provider:    sourceGitlab,
+		credentials: actions.Credentials{Host: "gitlab.example.com"},
+		settings:    currentSettings(),
+		dirs:        []string{"syncRepo", "archiveRepo", "moveRepo"},
+		move:        actions.Repos{moveRepo},
+		sync:        actions.Repos{moveRepo, {Name: "syncRepo", SSHURL: "git@github.com:foo/syncRepo.git"}},
+		clone:       actions.Repos{{Name: "cloneRepo", SSHURL: "git@github.com:foo/cloneRepo.git"}, cloneArchiveRepo},
+		archive:     actions.Repos{cloneArchiveRepo, {Name: "archiveRepo", Reason: actions.ReasonDeleted}},
+		keep:        actions.Repos{{Name: "keepRepo", Message: "still exists upstream"}},
+	}
+
+	path := dir + "/plan.json"
+	assert.NoError(t, plan.save(path))
+
+	// Applied with other settings
+	viper.Set("layout", "flat")
+	viper.Set("strategy", "reset")
+	viper.Set("protocol", "ssh")
+	viper.Set("archive-format", "dir")
+	viper.Set("mirror", false)
+	viper.Set("depth", 0)
+	viper.Set("sparse", nil)
+	viper.Set("repos", nil)
+
+	loaded, err := loadPlan(path)
+	assert.NoError(t, err)
+
+	assert.Len(t, loaded.settings, len(plan.settings))
+	assert.Equal(t, "owner/name", viper.GetString("layout"))
+	assert.Equal(t, "rebase", viper.GetString("strategy"))
+	assert.Equal(t, "https", viper.GetString("protocol"))
+	assert.Equal(t, "tar.gz", viper.GetString("archive-format"))
+	assert.True(t, viper.GetBool("mirror"))
+	assert.Equal(t, 1, viper.GetInt("depth"))
+	assert.Equal(t, []string{"docs"}, viper.GetStringSlice("sparse"))
+	assert.Equal(t, "blob:none", viper.GetString("repos.big.filter"))
+	assert.Equal(t, dir+"/.archive", viper.GetString("archive-dir"))
+	assert.Equal(t, dir, planDir(path))
+
+	assert.Equal(t, plan.dir, loaded.dir)
+	assert.Equal(t, plan.archiveDir, loaded.archiveDir)
+	assert.Equal(t, sourceGitlab, loaded.provider)
+	assert.Equal(t, actions.Credentials{Username: "oauth2", Token: "secret", Host: "gitlab.example.com"}, loaded.credentials)
+	assert.Equal(t, plan.dirs, loaded.dirs)
+	assert.Equal(t, plan.move, loaded.move)
+	assert.Equal(t, plan.sync, loaded.sync)
+	assert.Equal(t, plan.clone, loaded.clone)
+	assert.Equal(t, plan.archive, loaded.archive)
+	// Repos cloned straight into the archive must be the same repo in both lists
+	assert.True(t, loaded.clone[1] == loaded.archive[0])
+	assert.True(t, loaded.move[0] == loaded.sync[0])
+	assert.Equal(t, actions.Repos{{Name: "keepRepo", Message: "still exists upstream", Severity: actions.Warning}}, loaded.keep)
+}
+
+func TestLoadPlanInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	defer viper.Set("archive-dir", "")
+	defer viper.Set("layout", "")
+	defer viper.Set("strategy", "")
+
+	assert.NoError(t, ioutil.WriteFile(dir+"/version.json", []byte(`{"version": 1}`), 0644))
+	_, err = loadPlan(dir + "/version.json")
+	assert.EqualError(t, err, "plan "+dir+"/version.json has version 1 but only version 2 is supported")
+
+	assert.NoError(t, ioutil.WriteFile(dir+"/settings.json", []byte(`{"version": 2, "settings": {"strategy": "merge"}}`), 0644))
+	_, err = loadPlan(dir + "/settings.json")
+	assert.EqualError(t, err, "plan "+dir+"/settings.json has invalid settings: unknown sync strategy [merge], must be one of [fetch ff-only rebase reset]")
+
+	assert.NoError(t, ioutil.WriteFile(dir+"/action.json", []byte(`{"version": 2, "settings": {"layout": "flat", "strategy": "ff-only"}, "repos": [{"action": "sync+delete", "name": "foo"}]}`), 0644))
+	_, err = loadPlan(dir + "/action.json")
+	assert.EqualError(t, err, "plan "+dir+"/action.json has unknown action [sync+delete] for foo")
+
+	_, err = loadPlan(dir + "/missing.json")
+	assert.Error(t, err)
+	assert.Equal(t, "", planDir(dir+"/missing.json"))
+}
+
+func TestApplyTargetDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	plan := &syncPlan{dir: dir + "/download"}
+	assert.NoError(t, plan.save(dir+"/plan.json"))
+
+	// The config file in the download dir is read when applying
+	assert.Equal(t, dir+"/download", targetDir(applyCmd, []string{dir + "/plan.json"}))
+	assert.Equal(t, "", targetDir(&cobra.Command{}, []string{dir + "/plan.json"}))
+}
+
+func TestCheckDrift(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"repo1", "repo2"} {
+		assert.NoError(t, os.Mkdir(dir+"/"+name, 0755))
+		cmd := exec.Command("git", "init", "--quiet")
+		cmd.Dir = dir + "/" + name
+		assert.NoError(t, cmd.Run())
+	}
+
+	plan := &syncPlan{dir: dir, dirs: []string{"repo1", "repo2"}}
+	assert.NoError(t, plan.checkDrift())
+
+	plan.dirs = []string{"repo1", "repo3"}
+	assert.EqualError(t, plan.checkDrift(), dir+" has changed since the plan was made:\n  repo2 has been added\n  repo3 has been removed")
+}
@@ -0,0 +1,241 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/mitchellh/colorstring"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Provider is a git hosting service that can list the repos belonging to an
+// org, user or group. Each repo returned must carry everything needed to
+// clone it.
+type Provider interface {
+	RepoList(id string) (actions.Repos, error)
+}
+
+// CredentialProvider is implemented by providers whose token can be used to
+// clone and fetch over https
+type CredentialProvider interface {
+	Credentials() actions.Credentials
+}
+
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type action int
+
+const (
+	actionClone action = iota
+	actionSync
+	actionArchive
+	actionCloneArchive
+	actionNone
+)
+
+// addProviderFlags adds the flags common to every provider command.
+func addProviderFlags(cmd *cobra.Command) {
+	cmd.Flags().String("include", ".*", "Regex to match repo names against")
+	cmd.Flags().String("exclude", "^$", "Regex to exclude repo names against")
+	cmd.Flags().String("archive-dir", "", "Repo to put archived repos in\n(default is .archive in the download dir)")
+	addArchiveFormatFlag(cmd)
+	addCloneFlags(cmd)
+	addSafetyFlags(cmd)
+}
+
+// addArchiveFormatFlag adds the flag that decides how repos are archived.
+func addArchiveFormatFlag(cmd *cobra.Command) {
+	cmd.Flags().String("archive-format", string(actions.ArchiveFormatDir), `How repos are stored in the archive dir, one of:
+dir     move the repo dir as it is
+tar.gz  pack the repo dir into name.tar.gz
+bundle  keep only the commits in a git bundle name.bundle`)
+}
+
+// addCloneFlags adds the flags that limit how much of each repo is cloned.
+// They can also be set per repo under repos in the config files.
+func addCloneFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("depth", 0, "Clone only this many commits of history\n(0 clones all of it)")
+	cmd.Flags().String("filter", "", "Partial clone filter, e.g. blob:none only fetches file contents when needed")
+	cmd.Flags().Bool("single-branch", false, "Only clone the default branch")
+	cmd.Flags().StringSlice("sparse", nil, "Only check out these dirs of cloned repos")
+}
+
+// addSafetyFlags adds the flags that limit how many repos can be archived.
+func addSafetyFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("max-archive", defaultMaxArchive, "Refuse to archive more than this many existing repos without --force\n(0 disables the check)")
+	cmd.Flags().Int("max-archive-percent", defaultMaxArchivePercent, "Refuse to archive more than this percentage of existing repos without --force\n(0 disables the check)")
+	cmd.Flags().Bool("force", false, "Archive repos even if the archive limits are exceeded")
+}
+
+// runProvider syncs the download dir with the repos listed by p.
+func runProvider(p Provider, args []string) {
+	dir, archiveDir, id, inR, exR := processFlags(args)
+
+	repoList, err := listRepos(p, id)
+	if err != nil {
+		log.Println(err)
+		os.Exit(exitListing)
+	}
+
+	os.Exit(runSync(p, id, repoList, dir, archiveDir, inR, exR))
+}
+
+// listRepos gets the repos for id from p, showing that it is doing so
+func listRepos(p Provider, id string) (actions.Repos, error) {
+	fmt.Fprintf(out, "Getting remote repo list")
+
+	repoList, err := p.RepoList(id)
+	if err != nil {
+		fmt.Fprintln(out, "")
+		return nil, err
+	}
+
+	err = applyCloneURLTemplate(p, id, repoList)
+	if err != nil {
+		fmt.Fprintln(out, "")
+		return nil, err
+	}
+
+	if !viper.GetBool("verbose") {
+		fmt.Fprintln(out, "")
+	}
+
+	return repoList, nil
+}
+
+// checkFilters returns an error if --include or --exclude isn't a valid regex
+func checkFilters() error {
+	for _, flag := range []string{"include", "exclude"} {
+		_, err := regexp.Compile(viper.GetString(flag))
+		if err != nil {
+			return fmt.Errorf("invalid --%s regex: %s", flag, err)
+		}
+	}
+
+	return nil
+}
+
+func processFlags(args []string) (string, string, string, *regexp.Regexp, *regexp.Regexp) {
+	if viper.GetString("private") != "" {
+		colorstring.Fprint(out, "[red][--private=false] flag is deprecated please use [--search \"is:public\"] instead")
+		fmt.Fprintln(out, "")
+	}
+	if viper.GetString("forks") != "" {
+		colorstring.Fprint(out, "[red][--forks=false] flag is deprecated please use [--search \"fork:false\"] instead")
+		fmt.Fprintln(out, "")
+	}
+
+	id := args[0]
+
+	dir := filepath.Clean(args[1])
+
+	fmt.Fprintln(out, "=============")
+	fmt.Fprintf(out, "Syncing %s into %s\n", id, dir)
+
+	archiveDir := viper.GetString("archive-dir")
+	if archiveDir == "" {
+		archiveDir = fmt.Sprintf("%s/.archive", dir)
+	} else {
+		archiveDir = filepath.Clean(archiveDir)
+	}
+
+	fmt.Fprintf(out, "Archiving repos into %s\n", archiveDir)
+
+	inR := regexp.MustCompile(viper.GetString("include"))
+	exR := regexp.MustCompile(viper.GetString("exclude"))
+
+	fmt.Fprintln(out, "=============")
+
+	return dir, archiveDir, id, inR, exR
+}
+
+// runSync plans and executes the sync, clone and archive actions needed to make
+// dir match repoList and prints a summary of the results. It returns the exit
+// code for the run.
+func runSync(p Provider, id string, repoList actions.Repos, dir, archiveDir string, inR, exR *regexp.Regexp) int {
+	plan, err := newSyncPlan(p, id, repoList, dir, archiveDir, inR, exR)
+	if err != nil {
+		return planFailed(err)
+	}
+
+	return plan.execute()
+}
+
+func repoAction(repo *actions.Repo, dirList []string) (action, []string) {
+	for i, dir := range dirList {
+		if dir == repo.Name {
+			if repo.Archived {
+				dirList = actions.RemoveElementFromSlice(dirList, i)
+				return actionArchive, dirList
+			}
+
+			dirList = actions.RemoveElementFromSlice(dirList, i)
+
+			return actionSync, dirList
+		}
+	}
+
+	if !repo.Archived {
+		return actionClone, dirList
+	} else if repo.Archived {
+		return actionCloneArchive, dirList
+	}
+
+	return actionNone, dirList
+}
+
+func repoActions(
+	repoList actions.Repos,
+	dirList []string,
+	archiveDir string,
+	inR *regexp.Regexp,
+	exR *regexp.Regexp,
+) (actions.Repos, actions.Repos, actions.Repos) {
+	var reposToSync actions.Repos
+
+	var reposToClone actions.Repos
+
+	var reposToArchive actions.Repos
+
+	for _, repo := range repoList {
+		// Match the name of the repo rather than its path in the layout
+		name := actions.BaseName(repo.Name)
+		if inR.MatchString(name) && !exR.MatchString(name) {
+			var a action
+
+			a, dirList = repoAction(repo, dirList)
+			switch a {
+			case actionArchive:
+				repo.Reason = actions.ReasonArchived
+				reposToArchive = append(reposToArchive, repo)
+			case actionSync:
+				reposToSync = append(reposToSync, repo)
+			case actionClone:
+				reposToClone = append(reposToClone, repo)
+			case actionCloneArchive:
+				if !actions.InArchive(archiveDir, repo.Name) {
+					repo.Reason = actions.ReasonArchived
+					reposToArchive = append(reposToArchive, repo)
+					reposToClone = append(reposToClone, repo)
+				}
+			}
+		}
+	}
+
+	for _, dir := range dirList {
+		reposToArchive = append(reposToArchive, &actions.Repo{
+			Name:   dir,
+			Reason: actions.ReasonDeleted,
+		})
+	}
+
+	return reposToSync, reposToClone, reposToArchive
+}
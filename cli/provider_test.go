@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoActions(t *testing.T) {
+	type testCase struct {
+		tName           string
+		repo            *actions.Repo
+		dirList         []string
+		expectedAction  action
+		expectedDirList []string
+	}
+	testCases := []testCase{
+		{
+			tName: "repo to archive",
+			repo: &actions.Repo{
+				Name:     "archivedRepo",
+				Archived: true,
+				SSHURL:   "git@giturl/archivedRepo",
+			},
+			dirList:         []string{"archivedRepo", "syncRepo", "deletedRepo"},
+			expectedAction:  actionArchive,
+			expectedDirList: []string{"syncRepo", "deletedRepo"},
+		},
+		{
+			tName: "repo to clone",
+			repo: &actions.Repo{
+				Name:     "cloneRepo",
+				Archived: false,
+				SSHURL:   "git@giturl/cloneRepo",
+			},
+			dirList:         []string{"archivedRepo", "syncRepo", "deletedRepo"},
+			expectedAction:  actionClone,
+			expectedDirList: []string{"archivedRepo", "syncRepo", "deletedRepo"},
+		},
+		{
+			tName: "repo to sync",
+			repo: &actions.Repo{
+				Name:     "syncRepo",
+				Archived: false,
+				SSHURL:   "git@giturl/syncRepo",
+			},
+			dirList:         []string{"archivedRepo", "syncRepo", "deletedRepo"},
+			expectedAction:  actionSync,
+			expectedDirList: []string{"archivedRepo", "deletedRepo"},
+		},
+		{
+			tName: "repo to clone and archive",
+			repo: &actions.Repo{
+				Name:     "cloneArchiveRepo",
+				Archived: true,
+				SSHURL:   "git@giturl/cloneArchiveRepo",
+			},
+			dirList:         []string{"archivedRepo", "syncRepo", "deletedRepo"},
+			expectedAction:  actionCloneArchive,
+			expectedDirList: []string{"archivedRepo", "syncRepo", "deletedRepo"},
+		},
+	}
+	var repos actions.Repos
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			action, dirList := repoAction(tc.repo, tc.dirList)
+			assert.Equal(t, tc.expectedAction, action)
+			assert.Equal(t, tc.expectedDirList, dirList)
+		})
+		repos = append(repos, tc.repo)
+	}
+
+	inR, _ := regexp.Compile(".*")
+	exR, _ := regexp.Compile("^$")
+	reposToSync, reposToClone, reposToArchive := repoActions(repos, []string{"archivedRepo", "syncRepo", "deletedRepo"}, "foobar", inR, exR)
+
+	assert.Equal(t, actions.Repos{
+		&actions.Repo{
+			Name:   "syncRepo",
+			SSHURL: "git@giturl/syncRepo",
+		},
+	}, reposToSync)
+
+	assert.Equal(t, actions.Repos{
+		&actions.Repo{
+			Name:   "cloneRepo",
+			SSHURL: "git@giturl/cloneRepo",
+		},
+		&actions.Repo{
+			Name:     "cloneArchiveRepo",
+			Archived: true,
+			SSHURL:   "git@giturl/cloneArchiveRepo",
+			Reason:   actions.ReasonArchived,
+		},
+	}, reposToClone)
+
+	assert.Equal(t, actions.Repos{
+		&actions.Repo{
+			Name:     "archivedRepo",
+			Archived: true,
+			SSHURL:   "git@giturl/archivedRepo",
+			Reason:   actions.ReasonArchived,
+		},
+		&actions.Repo{
+			Name:     "cloneArchiveRepo",
+			Archived: true,
+			SSHURL:   "git@giturl/cloneArchiveRepo",
+			Reason:   actions.ReasonArchived,
+		},
+		&actions.Repo{
+			Name:   "deletedRepo",
+			Reason: actions.ReasonDeleted,
+		},
+	}, reposToArchive)
+}
+
+func TestRepoActionsMirror(t *testing.T) {
+	viper.Set("mirror", true)
+	defer viper.Set("mirror", false)
+
+	repos := actions.Repos{{Name: "api", SSHURL: "git@giturl/api"}, {Name: "api-old", SSHURL: "git@giturl/api-old"}}
+	repos.ApplyLayout(actions.LayoutFlat)
+
+	reposToSync, reposToClone, reposToArchive := repoActions(
+		repos,
+		[]string{"api.git", "deleted.git"},
+		"foobar",
+		regexp.MustCompile(".*"),
+		regexp.MustCompile("-old$"),
+	)
+
+	assert.Equal(t, actions.Repos{{Name: "api.git", SSHURL: "git@giturl/api"}}, reposToSync)
+	assert.Nil(t, reposToClone)
+	assert.Equal(t, actions.Repos{{Name: "deleted.git", Reason: actions.ReasonDeleted}}, reposToArchive)
+}
+
+func TestProcessFlags(t *testing.T) {
+	dir, archiveDir, org, inR, exR := processFlags([]string{"foobar", "/tmp/foobar"})
+	assert.Equal(t, "/tmp/foobar", dir)
+	assert.Equal(t, "/tmp/foobar/.archive", archiveDir)
+	assert.Equal(t, "foobar", org)
+	expectedInR, _ := regexp.Compile(".*")
+	assert.Equal(t, expectedInR, inR)
+	expectedExR, _ := regexp.Compile("^$")
+	assert.Equal(t, expectedExR, exR)
+}
+
+func TestCheckFilters(t *testing.T) {
+	defer viper.Set("exclude", "^$")
+
+	assert.NoError(t, checkFilters())
+
+	viper.Set("exclude", "(")
+	assert.EqualError(t, checkFilters(), "invalid --exclude regex: error parsing regexp: missing closing ): `(`")
+}
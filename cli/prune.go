@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/mitchellh/colorstring"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const defaultRetention = "90d"
+
+var pruneArchiveCmd = &cobra.Command{
+	Use:   "prune-archive [download dir]",
+	Short: "Delete packed archives older than the retention window",
+	Long: `Delete repos packed with --archive-format tar.gz or bundle that were archived longer ago
+than --retention. Repos archived as plain dirs are never deleted.`,
+	Example: `To delete archives in ~/download/dir/.archive older than six months
+> git-mass-sync prune-archive ~/download/dir --retention 180d`,
+	//nolint:gomnd
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{targetDirArg: "0"},
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(runPruneArchive(args[0]))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pruneArchiveCmd)
+
+	pruneArchiveCmd.Flags().String("archive-dir", "", "Dir to prune\n(default is .archive in the download dir)")
+	pruneArchiveCmd.Flags().String("retention", defaultRetention, "Delete archives older than this e.g. 30d or 720h")
+}
+
+// parseRetention parses a duration that can also be given in days
+func parseRetention(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid retention [%s]", s)
+		}
+
+		return time.Duration(days) * 24 * time.Hour, nil //nolint:gomnd
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retention [%s]", s)
+	}
+
+	return d, nil
+}
+
+// expiredArchives returns the archives archived before cutoff
+func expiredArchives(archives []*actions.PackedArchive, cutoff time.Time) []*actions.PackedArchive {
+	var expired []*actions.PackedArchive
+
+	for _, archive := range archives {
+		if archive.Metadata.ArchivedAt.Before(cutoff) {
+			expired = append(expired, archive)
+		}
+	}
+
+	return expired
+}
+
+func runPruneArchive(dir string) int {
+	dir = filepath.Clean(dir)
+
+	archiveDir := viper.GetString("archive-dir")
+	if archiveDir == "" {
+		archiveDir = fmt.Sprintf("%s/.archive", dir)
+	} else {
+		archiveDir = filepath.Clean(archiveDir)
+	}
+
+	retention, err := parseRetention(viper.GetString("retention"))
+	if err != nil {
+		colorstring.Fprintf(out, "[red]%s\n", err)
+		return exitError
+	}
+
+	archives, err := actions.PackedArchives(archiveDir)
+	if err != nil {
+		colorstring.Fprintf(out, "[red]Unable to read archives in %s: %s\n", archiveDir, err)
+		return exitError
+	}
+
+	expired := expiredArchives(archives, time.Now().Add(-retention))
+	code := exitOK
+
+	for _, archive := range expired {
+		days := int(time.Since(archive.Metadata.ArchivedAt).Hours() / 24) //nolint:gomnd
+
+		if viper.GetBool("dry-run") {
+			colorstring.Fprintf(out, "[light_magenta]Would delete %s archived %d days ago\n", archive.Path, days)
+			continue
+		}
+
+		colorstring.Fprintf(out, "[light_magenta]Deleting %s archived %d days ago\n", archive.Path, days)
+
+		err := actions.RemovePacked(archiveDir, archive)
+		if err != nil {
+			colorstring.Fprintf(out, "[red]Unable to delete %s: %s\n", archive.Path, err)
+			code = exitError
+		}
+	}
+
+	fmt.Fprintf(out, "%d of %d archives older than %s\n", len(expired), len(archives), viper.GetString("retention"))
+
+	return code
+}
@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetention(t *testing.T) {
+	d, err := parseRetention("30d")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*24*time.Hour, d)
+
+	d, err = parseRetention("36h")
+	assert.NoError(t, err)
+	assert.Equal(t, 36*time.Hour, d)
+
+	_, err = parseRetention("a month")
+	assert.EqualError(t, err, "invalid retention [a month]")
+}
+
+func TestExpiredArchives(t *testing.T) {
+	now := time.Now()
+	old := &actions.PackedArchive{Path: "old.tar.gz", Metadata: actions.ArchiveMetadata{ArchivedAt: now.Add(-100 * 24 * time.Hour)}}
+	recent := &actions.PackedArchive{Path: "recent.bundle", Metadata: actions.ArchiveMetadata{ArchivedAt: now.Add(-time.Hour)}}
+
+	expired := expiredArchives([]*actions.PackedArchive{old, recent}, now.Add(-90*24*time.Hour))
+	assert.Equal(t, []*actions.PackedArchive{old}, expired)
+}
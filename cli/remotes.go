@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/template"
+	"time"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/mitchellh/colorstring"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var rewriteRemotesCmd = &cobra.Command{
+	Use:   "rewrite-remotes",
+	Short: "Point the origin of already cloned repos at their clone url",
+	Long: `Point the origin of every repo in the download dir that is in the repo list at the url it
+would be cloned with now, taking --clone-url-template and --protocol into account.`,
+	Example: `> git-mass-sync rewrite-remotes github foobar ~/download/dir --clone-url-template "git@github-work:{{.Owner}}/{{.Name}}.git"`,
+}
+
+func init() {
+	rootCmd.AddCommand(rewriteRemotesCmd)
+
+	for _, cmd := range []*cobra.Command{newGithubCmd(runRewriteRemotes), newGitlabCmd(runRewriteRemotes)} {
+		cmd.Example = ""
+		rewriteRemotesCmd.AddCommand(cmd)
+	}
+}
+
+// cloneURLData is what --clone-url-template is executed with
+type cloneURLData struct {
+	*actions.Repo
+	// Provider is github or gitlab
+	Provider string
+	// Source is the org, user or group the repos were listed from
+	Source string
+}
+
+// parseCloneURLTemplate returns the parsed --clone-url-template, which is nil
+// if it isn't set
+func parseCloneURLTemplate() (*template.Template, error) {
+	text := viper.GetString("clone-url-template")
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("clone-url-template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clone url template: %s", err)
+	}
+
+	return tmpl, nil
+}
+
+func providerName(p Provider) string {
+	switch p.(type) {
+	case githubProvider:
+		return sourceGithub
+	case gitlabProvider:
+		return sourceGitlab
+	}
+
+	return ""
+}
+
+// applyCloneURLTemplate sets the url of every repo to --clone-url-template
+// executed with it. It must run before the layout is applied so the name of
+// each repo is just its name.
+func applyCloneURLTemplate(p Provider, id string, repos actions.Repos) error {
+	tmpl, err := parseCloneURLTemplate()
+	if err != nil || tmpl == nil {
+		return err
+	}
+
+	for _, repo := range repos {
+		var b bytes.Buffer
+
+		err := tmpl.Execute(&b, cloneURLData{Repo: repo, Provider: providerName(p), Source: id})
+		if err != nil {
+			return fmt.Errorf("unable to make clone url for %s: %s", repo.Name, err)
+		}
+
+		repo.URL = b.String()
+	}
+
+	return nil
+}
+
+// remotesToRewrite returns the repos in dirList whose origin isn't their
+// clone url
+func remotesToRewrite(dir string, repoList actions.Repos, dirList []string, inR, exR *regexp.Regexp) actions.Repos {
+	present := map[string]bool{}
+	for _, d := range dirList {
+		present[d] = true
+	}
+
+	var rewrite actions.Repos
+
+	for _, repo := range repoList {
+		name := actions.BaseName(repo.Name)
+		if !present[repo.Name] || !inR.MatchString(name) || exR.MatchString(name) {
+			continue
+		}
+
+		url, err := actions.RemoteURL(context.Background(), filepath.Join(dir, repo.Name))
+		if err == nil && actions.SameURL(url, repo.CloneURL()) {
+			continue
+		}
+
+		rewrite = append(rewrite, repo)
+	}
+
+	return rewrite
+}
+
+// runRewriteRemotes points the origin of the repos listed by p that are in
+// the download dir at their clone url
+func runRewriteRemotes(p Provider, args []string) {
+	started := time.Now()
+
+	dir, _, id, inR, exR := processFlags(args)
+
+	repoList, err := listRepos(p, id)
+	if err != nil {
+		colorstring.Fprintf(out, "[red]Failed to get repo list: %s\n", err)
+		os.Exit(exitListing)
+	}
+
+	repoList.ApplyLayout(actions.Layout(viper.GetString("layout")))
+
+	dirList, err := actions.GetGitDirList(dir)
+	if err != nil {
+		colorstring.Fprintf(out, "[red]Unable to read %s: %s\n", dir, err)
+		os.Exit(exitError)
+	}
+
+	rewrite := remotesToRewrite(dir, repoList, dirList, inR, exR)
+
+	fmt.Fprintln(out, "=============")
+	colorstring.Fprintf(out, "[blue]%d remotes to rewrite\n", len(rewrite))
+	fmt.Fprintln(out, "=============")
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	rewrite.SetRemotes(ctx, dir)
+
+	os.Exit(reportResults(ctx, dir, "", started, resultGroup{action: "Rewrite", done: "rewritten", color: "blue", repos: rewrite}))
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyCloneURLTemplate(t *testing.T) {
+	repos := actions.Repos{{Name: "docs", Owner: "foo", Host: "github.com"}}
+
+	assert.NoError(t, applyCloneURLTemplate(githubProvider{}, "foo", repos))
+	assert.Equal(t, "", repos[0].URL)
+
+	viper.Set("clone-url-template", "git@{{.Provider}}-work:{{.Source}}/{{.Name}}.git")
+	defer viper.Set("clone-url-template", "")
+
+	assert.NoError(t, applyCloneURLTemplate(githubProvider{}, "foo", repos))
+	assert.Equal(t, "git@github-work:foo/docs.git", repos[0].URL)
+	assert.Equal(t, "git@github-work:foo/docs.git", repos[0].CloneURL())
+
+	viper.Set("clone-url-template", "{{.Missing}}")
+	assert.EqualError(
+		t,
+		applyCloneURLTemplate(gitlabProvider{}, "foo", repos),
+		`unable to make clone url for docs: template: clone-url-template:1:2: executing "clone-url-template" at <.Missing>: can't evaluate field Missing in type cli.cloneURLData`,
+	)
+
+	viper.Set("clone-url-template", "{{.Name")
+	_, err := parseCloneURLTemplate()
+	assert.EqualError(t, err, "invalid clone url template: template: clone-url-template:1: unclosed action")
+}
+
+func TestRemotesToRewrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	remotes := map[string]string{
+		"current":  "git@github-work:foo/current.git",
+		"old":      "git@github.com:foo/old.git",
+		"excluded": "git@github.com:foo/excluded.git",
+		"suffix":   "git@github-work:Foo/suffix",
+	}
+	for repo, url := range remotes {
+		initRepo(t, dir+"/"+repo)
+		runGit(t, dir+"/"+repo, "remote", "add", "origin", url)
+	}
+
+	current := &actions.Repo{Name: "current", URL: "git@github-work:foo/current.git"}
+	old := &actions.Repo{Name: "old", URL: "git@github-work:foo/old.git"}
+	excluded := &actions.Repo{Name: "excluded", URL: "git@github-work:foo/excluded.git"}
+	missing := &actions.Repo{Name: "missing", URL: "git@github-work:foo/missing.git"}
+	// Only differs in case and the .git suffix
+	suffix := &actions.Repo{Name: "suffix", URL: "git@github-work:foo/suffix.git"}
+
+	rewrite := remotesToRewrite(
+		dir,
+		actions.Repos{current, old, excluded, missing, suffix},
+		[]string{"current", "excluded", "old", "suffix"},
+		regexp.MustCompile(".*"),
+		regexp.MustCompile("^excluded$"),
+	)
+	assert.Equal(t, actions.Repos{old}, rewrite)
+}
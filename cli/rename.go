@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/lhopki01/git-mass-sync/debug"
+)
+
+// detectRenames finds repos about to be cloned that are already in dir under
+// another name because they were renamed or transferred upstream. Instead of
+// cloning them and archiving the old dir, the old dir is moved so local
+// branches, stashes and build output are kept. A local dir is matched to a
+// repo by the ID stored when it was cloned, then by its origin url and then,
+// if getter is set, by looking up its old name upstream, which follows
+// renames on github. It returns the repos still to clone and archive, the
+// repos to move and the local repos kept with a warning as looking them up
+// failed.
+func detectRenames(
+	dir string,
+	getter RepoGetter,
+	id string,
+	reposToClone, reposToArchive actions.Repos,
+) (actions.Repos, actions.Repos, actions.Repos, actions.Repos) {
+	var clone, archive, moves, keep actions.Repos
+
+	moved := map[*actions.Repo]bool{}
+
+	for _, old := range reposToArchive {
+		// Only repos found locally but not in the repo list have no url
+		if old.SSHURL != "" {
+			archive = append(archive, old)
+			continue
+		}
+
+		repo, err := renamedTo(dir, old.Name, getter, id, reposToClone)
+		if err != nil {
+			old.Severity = actions.Warning
+			old.Message = fmt.Sprintf("not archiving as unable to tell if it was renamed upstream: %s", err)
+			keep = append(keep, old)
+
+			continue
+		}
+
+		if repo == nil || moved[repo] {
+			archive = append(archive, old)
+			continue
+		}
+
+		debug.Debugf("[%s] was renamed or transferred to %s", old.Name, repo.Name)
+
+		moved[repo] = true
+		repo.OldName = old.Name
+		moves = append(moves, repo)
+	}
+
+	for _, repo := range reposToClone {
+		if !moved[repo] {
+			clone = append(clone, repo)
+		}
+	}
+
+	return clone, archive, moves, keep
+}
+
+// renamedTo returns the repo in reposToClone that the local repo name is an
+// old copy of, if any
+func renamedTo(dir, name string, getter RepoGetter, id string, reposToClone actions.Repos) (*actions.Repo, error) {
+	ctx := context.Background()
+	localDir := fmt.Sprintf("%s/%s", dir, name)
+
+	if localID := actions.RepoID(ctx, localDir); localID != "" {
+		for _, repo := range reposToClone {
+			if repo.ID == localID {
+				return repo, nil
+			}
+		}
+	}
+
+	if url, err := actions.RemoteURL(ctx, localDir); err == nil {
+		for _, repo := range reposToClone {
+			if repo.HasURL(url) {
+				return repo, nil
+			}
+		}
+	}
+
+	if getter == nil {
+		return nil, nil
+	}
+
+	namespace, ok := upstreamNamespace(dir, id, name)
+	if !ok {
+		return nil, nil
+	}
+
+	upstream, err := getter.GetRepo(namespace, actions.BaseName(name))
+	if err != nil || upstream == nil {
+		return nil, err
+	}
+
+	for _, repo := range reposToClone {
+		if (upstream.ID != "" && repo.ID == upstream.ID) || repo.HasURL(upstream.SSHURL) {
+			return repo, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// cachedGetter only looks up each repo once, as both rename detection and
+// confirming repos were deleted look up the same repos
+type cachedGetter struct {
+	getter RepoGetter
+	repos  map[string]cachedRepo
+}
+
+type cachedRepo struct {
+	repo *actions.Repo
+	err  error
+}
+
+func newCachedGetter(getter RepoGetter) *cachedGetter {
+	return &cachedGetter{getter: getter, repos: map[string]cachedRepo{}}
+}
+
+func (c *cachedGetter) GetRepo(namespace, name string) (*actions.Repo, error) {
+	key := namespace + "/" + name
+
+	if cached, ok := c.repos[key]; ok {
+		return cached.repo, cached.err
+	}
+
+	repo, err := c.getter.GetRepo(namespace, name)
+	c.repos[key] = cachedRepo{repo: repo, err: err}
+
+	return repo, err
+}
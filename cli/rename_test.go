@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingGetter counts how many times each repo is looked up
+type countingGetter struct {
+	fakeGetter
+	calls map[string]int
+}
+
+func (c countingGetter) GetRepo(namespace, name string) (*actions.Repo, error) {
+	c.calls[name]++
+	return c.fakeGetter.GetRepo(namespace, name)
+}
+
+func TestDetectRenames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, repo := range []string{"oldID", "oldURL", "oldAPI", "gone", "brokenRepo"} {
+		initRepo(t, dir+"/"+repo)
+	}
+	runGit(t, dir+"/oldID", "config", "gms.id", "github.com/1")
+	runGit(t, dir+"/oldURL", "remote", "add", "origin", "git@github.com:foo/newURL.git")
+	runGit(t, dir+"/oldAPI", "remote", "add", "origin", "git@github.com:foo/oldAPI.git")
+	runGit(t, dir+"/gone", "remote", "add", "origin", "git@github.com:foo/gone.git")
+	runGit(t, dir+"/brokenRepo", "remote", "add", "origin", "git@github.com:foo/brokenRepo.git")
+
+	newID := &actions.Repo{Name: "newID", SSHURL: "git@github.com:foo/newID.git", ID: "github.com/1"}
+	newURL := &actions.Repo{Name: "newURL", SSHURL: "git@github.com:foo/newURL.git", ID: "github.com/2"}
+	newAPI := &actions.Repo{Name: "newAPI", SSHURL: "git@github.com:foo/newAPI.git", ID: "github.com/3"}
+	newRepo := &actions.Repo{Name: "newRepo", SSHURL: "git@github.com:foo/newRepo.git", ID: "github.com/4"}
+	listedRepo := &actions.Repo{Name: "listedRepo", SSHURL: "git@github.com:foo/listedRepo.git", Archived: true}
+	gone := &actions.Repo{Name: "gone"}
+	broken := &actions.Repo{Name: "brokenRepo"}
+
+	getter := countingGetter{
+		fakeGetter: fakeGetter{"foo/oldAPI": &actions.Repo{Name: "newAPI", ID: "github.com/3"}},
+		calls:      map[string]int{},
+	}
+	cached := newCachedGetter(getter)
+
+	clone, archive, moves, keep := detectRenames(
+		dir,
+		cached,
+		"foo",
+		actions.Repos{newID, newURL, newAPI, newRepo, listedRepo},
+		actions.Repos{listedRepo, &actions.Repo{Name: "oldID"}, &actions.Repo{Name: "oldURL"}, &actions.Repo{Name: "oldAPI"}, gone, broken},
+	)
+
+	assert.Equal(t, actions.Repos{newRepo, listedRepo}, clone)
+	assert.Equal(t, actions.Repos{listedRepo, gone}, archive)
+	assert.Equal(t, actions.Repos{newID, newURL, newAPI}, moves)
+	assert.Equal(t, "oldID", newID.OldName)
+	assert.Equal(t, "oldURL", newURL.OldName)
+	assert.Equal(t, "oldAPI", newAPI.OldName)
+
+	// Repos that can't be looked up are kept rather than archived
+	assert.Equal(t, actions.Repos{broken}, keep)
+	assert.Equal(t, actions.Warning, broken.Severity)
+	assert.Equal(t, "not archiving as unable to tell if it was renamed upstream: boom", broken.Message)
+
+	// Confirming gone was deleted doesn't look it up again
+	toArchive, _ := confirmDeleted(cached, dir, "foo", archive)
+	assert.Equal(t, actions.Repos{listedRepo, gone}, toArchive)
+	assert.Equal(t, map[string]int{"oldAPI": 1, "gone": 1, "brokenRepo": 1}, getter.calls)
+}
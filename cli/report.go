@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/spf13/viper"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// reportOut is where the json report is written with --output json. Everything
+// else is written to out, which is then stderr so stdout only contains the report.
+var (
+	reportOut io.Writer = os.Stdout
+	out       io.Writer = os.Stdout
+)
+
+// runReport is the machine readable record of a run
+type runReport struct {
+	// Dir is empty when syncing several dirs from a manifest
+	Dir        string        `json:"dir,omitempty"`
+	ArchiveDir string        `json:"archive_dir,omitempty"`
+	DryRun     bool          `json:"dry_run"`
+	StartedAt  time.Time     `json:"started_at"`
+	Duration   float64       `json:"duration_seconds"`
+	Repos      []*repoReport `json:"repos"`
+}
+
+type repoReport struct {
+	Name string `json:"name"`
+	// Action is the planned action e.g. "sync" or "clone+archive"
+	Action   string                 `json:"action"`
+	Outcome  string                 `json:"outcome"`
+	Severity actions.Severity       `json:"severity"`
+	Duration float64                `json:"duration_seconds"`
+	Attempts int                    `json:"attempts,omitempty"`
+	Output   string                 `json:"output"`
+	Branches []actions.BranchResult `json:"branches,omitempty"`
+	// ArchiveReason is why the repo was archived
+	ArchiveReason actions.ArchiveReason `json:"archive_reason,omitempty"`
+}
+
+// setupOutput checks --output and, for json, sends everything but the
+// report to stderr. It must run before anything is printed.
+func setupOutput() error {
+	switch viper.GetString("output") {
+	case outputText:
+	case outputJSON:
+		out = os.Stderr
+		actions.SetOutput(os.Stderr)
+	default:
+		return fmt.Errorf("unknown output format [%s], must be one of [%s %s]", viper.GetString("output"), outputText, outputJSON)
+	}
+
+	return nil
+}
+
+// reportResults prints the summary of a run and writes the json report if
+// one was asked for. It returns the exit code for the run.
+func reportResults(ctx context.Context, dir, archiveDir string, started time.Time, groups ...resultGroup) int {
+	printSummary(groups...)
+
+	code := exitCode(groups)
+	if ctx.Err() != nil {
+		code = exitInterrupted
+	}
+
+	reportFile := viper.GetString("report-file")
+	if viper.GetString("output") != outputJSON && reportFile == "" {
+		return code
+	}
+
+	b, err := json.MarshalIndent(newRunReport(dir, archiveDir, started, groups), "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create report: %s\n", err)
+		return exitError
+	}
+
+	b = append(b, '\n')
+
+	if viper.GetString("output") == outputJSON {
+		_, err = reportOut.Write(b)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write report: %s\n", err)
+			return exitError
+		}
+	}
+
+	if reportFile != "" {
+		err = ioutil.WriteFile(reportFile, b, 0644) //nolint:gosec
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write report to %s: %s\n", reportFile, err)
+			return exitError
+		}
+	}
+
+	return code
+}
+
+// newRunReport builds a report with one entry per repo. Repos in more than
+// one group, such as those cloned straight into the archive, have their
+// actions joined with a "+".
+func newRunReport(dir, archiveDir string, started time.Time, groups []resultGroup) runReport {
+	r := runReport{
+		Dir:        dir,
+		ArchiveDir: archiveDir,
+		DryRun:     viper.GetBool("dry-run"),
+		StartedAt:  started,
+		Duration:   time.Since(started).Seconds(),
+		Repos:      []*repoReport{},
+	}
+
+	seen := map[*actions.Repo]*repoReport{}
+
+	for _, g := range groups {
+		action := strings.ToLower(g.action)
+
+		for _, repo := range g.repos {
+			if rr, ok := seen[repo]; ok {
+				rr.Action += "+" + action
+				rr.Outcome = outcome(repo, g)
+
+				continue
+			}
+
+			rr := &repoReport{
+				Name:     repo.Name,
+				Action:   action,
+				Outcome:  outcome(repo, g),
+				Severity: repo.Severity,
+				Duration: repo.Duration.Seconds(),
+				Attempts: repo.Attempts,
+				Output:   repo.Message,
+				Branches: repo.Branches,
+				// Only repos to archive have a reason
+				ArchiveReason: repo.Reason,
+			}
+			seen[repo] = rr
+			r.Repos = append(r.Repos, rr)
+		}
+	}
+
+	return r
+}
+
+func outcome(repo *actions.Repo, g resultGroup) string {
+	switch {
+	case viper.GetBool("dry-run"):
+		return "planned"
+	case repo.Severity == actions.Error:
+		return "failed"
+	case repo.Severity == actions.Warning && g.warningSkips:
+		return "skipped"
+	}
+
+	return "ok"
+}
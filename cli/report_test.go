@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRunReport(t *testing.T) {
+	syncRepo := &actions.Repo{Name: "syncRepo", Duration: time.Second, Attempts: 1}
+	failedRepo := &actions.Repo{Name: "failedRepo", Severity: actions.Error, Message: "fatal: boom\n", Attempts: 3}
+	cloneArchiveRepo := &actions.Repo{Name: "cloneArchiveRepo", Archived: true, Reason: actions.ReasonArchived}
+	dirtyRepo := &actions.Repo{Name: "dirtyRepo", Severity: actions.Warning, Message: "not archiving as it has 1 stashes"}
+
+	started := time.Now()
+	r := newRunReport("/tmp/foo", "/tmp/foo/.archive", started, []resultGroup{
+		{action: "Sync", repos: actions.Repos{syncRepo}},
+		{action: "Clone", repos: actions.Repos{failedRepo, cloneArchiveRepo}},
+		{action: "Archive", repos: actions.Repos{cloneArchiveRepo, dirtyRepo}, warningSkips: true},
+	})
+
+	assert.Equal(t, "/tmp/foo", r.Dir)
+	assert.Equal(t, "/tmp/foo/.archive", r.ArchiveDir)
+	assert.Equal(t, started, r.StartedAt)
+	assert.Equal(t, []*repoReport{
+		{Name: "syncRepo", Action: "sync", Outcome: "ok", Severity: actions.Info, Duration: 1, Attempts: 1},
+		{Name: "failedRepo", Action: "clone", Outcome: "failed", Severity: actions.Error, Output: "fatal: boom\n", Attempts: 3},
+		{Name: "cloneArchiveRepo", Action: "clone+archive", Outcome: "ok", Severity: actions.Info, ArchiveReason: actions.ReasonArchived},
+		{Name: "dirtyRepo", Action: "archive", Outcome: "skipped", Severity: actions.Warning, Output: "not archiving as it has 1 stashes"},
+	}, r.Repos)
+}
+
+func TestSetupOutput(t *testing.T) {
+	stdout := os.Stdout
+	defer func() {
+		out = os.Stdout
+		actions.SetOutput(os.Stdout)
+	}()
+	defer viper.Set("output", "")
+
+	viper.Set("output", outputJSON)
+	assert.NoError(t, setupOutput())
+
+	// Only the report is written to stdout, which is left alone
+	assert.Equal(t, os.Stderr, out)
+	assert.Equal(t, os.Stdout, reportOut)
+	assert.Equal(t, stdout, os.Stdout)
+
+	viper.Set("output", "yaml")
+	assert.EqualError(t, setupOutput(), "unknown output format [yaml], must be one of [text json]")
+}
@@ -15,26 +15,131 @@
 package cli
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/mitchellh/colorstring"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+const defaultRetries = 2
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "git-mass-sync [org] [download dir]",
 	Short: "Utility to mass download all git repos",
+	// Several subcommands share flag names such as --include, so bind the
+	// flags of the command actually being run to make sure they win.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		err := viper.BindPFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		err = loadConfig(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		err = checkSettings()
+		if err != nil {
+			return err
+		}
+
+		_, err = parseCloneURLTemplate()
+		if err != nil {
+			return err
+		}
+
+		err = checkFilters()
+		if err != nil {
+			return err
+		}
+
+		err = checkFailOn()
+		if err != nil {
+			return err
+		}
+
+		return setupOutput()
+	},
+}
+
+// checkSettings returns an error if any of the settings that choose between
+// ways of syncing is invalid
+func checkSettings() error {
+	_, err := actions.ParseStrategy(viper.GetString("strategy"))
+	if err != nil {
+		return err
+	}
+
+	_, err = actions.ParseLayout(viper.GetString("layout"))
+	if err != nil {
+		return err
+	}
+
+	_, err = actions.ParseArchiveFormat(viper.GetString("archive-format"))
+	if err != nil {
+		return err
+	}
+
+	_, err = actions.ParseProtocol(viper.GetString("protocol"))
+
+	return err
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Git runs this binary to get the token when cloning over https
+	askpass, err := actions.RunAskpass(os.Args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
+	}
+
+	if askpass {
+		return
+	}
+
+	if err = rootCmd.Execute(); err != nil {
 		log.Println(err)
-		//nolint:gomnd
-		os.Exit(1)
+		os.Exit(exitError)
+	}
+}
+
+// interruptContext returns a context that is cancelled on the first Ctrl-C so
+// in flight git commands are stopped and the summary can still be printed. A
+// second Ctrl-C exits immediately.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2) //nolint:gomnd
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+			//nolint:errcheck
+			colorstring.Fprintln(os.Stderr, "\n[red]Interrupted, cancelling remaining operations. Press Ctrl-C again to exit immediately")
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+
+		<-signals
+		os.Exit(exitInterrupted)
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
 	}
 }
 
@@ -42,6 +147,33 @@ func init() {
 	rootCmd.PersistentFlags().BoolP("dry-run", "n", false, "Show what would happen")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Make the operation more talkative")
 	rootCmd.PersistentFlags().Int("parallelism", 50, "Max parallel processes to run")
+	rootCmd.PersistentFlags().String("fail-on", failOnError, `When to exit non zero, one of:
+error    exit 2 if any repo failed
+warning  also exit 1 if any repo had a warning`)
+	rootCmd.PersistentFlags().StringP("output", "o", outputText, "Output format, one of text or json\nWith json the report is written to stdout and everything else to stderr")
+	rootCmd.PersistentFlags().String("report-file", "", "Also write the json report to this file")
+	rootCmd.PersistentFlags().Duration("timeout", 0, "Max time a single clone, sync or archive can take, e.g. 30m\n(default is no limit)")
+	rootCmd.PersistentFlags().Int("retries", defaultRetries, "Times to retry a clone or fetch that fails with a network or server error")
+	rootCmd.PersistentFlags().String("strategy", string(actions.StrategyFFOnly), `How to update local branches when syncing:
+fetch    only fetch, never touch local branches or working trees
+ff-only  fast-forward branches that are behind their upstream
+rebase   also rebase diverged branches onto their upstream when clean
+reset    hard reset every branch to its upstream, discarding local work`)
+	rootCmd.PersistentFlags().String("layout", string(actions.LayoutFlat), `Where repos are put in the download dir, one of:
+flat             dir/name
+owner/name       dir/owner/name
+host/owner/name  dir/host/owner/name
+Repos already in dir/name are moved into the layout`)
+	rootCmd.PersistentFlags().String("protocol", "", `How to clone and fetch repos, one of:
+ssh    use the ssh url and your ssh keys
+https  use the https url and the provider token, which is never written to .git/config
+When set existing clones are fetched with it too (default is to clone with ssh
+and fetch with the url of each remote)`)
+	rootCmd.PersistentFlags().Bool("mirror", false, "Keep bare mirror clones in dir/name.git, updated with git remote update --prune,\ninstead of working copies")
+	rootCmd.PersistentFlags().String("clone-url-template", "", `Go template for the url to clone repos with instead, e.g.
+git@github-work:{{.Owner}}/{{.Name}}.git
+Repo fields such as .Name, .Owner, .Host, .SSHURL and .HTTPSURL
+and .Provider and .Source, the org or group, can be used`)
 
 	err := viper.BindPFlags(rootCmd.PersistentFlags())
 	if err != nil {
@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/lhopki01/git-mass-sync/debug"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultMaxArchive        = 50
+	defaultMaxArchivePercent = 25
+	// Small numbers of archives are always allowed by the percentage check so
+	// that small download dirs can still be tidied up
+	minArchiveForPercent = 5
+)
+
+// RepoGetter is implemented by providers that can look up a single repo. It
+// is used to confirm that repos missing from the repo list really have been
+// deleted upstream before they are archived.
+type RepoGetter interface {
+	// GetRepo returns the repo name in namespace, which is the full path of its
+	// owner including any subgroups. It returns nil without an error if the
+	// repo does not exist.
+	GetRepo(namespace, name string) (*actions.Repo, error)
+}
+
+// confirmDeleted looks up every repo to archive that was not in the repo list.
+// Repos that still exist upstream and are not archived there, or that can't be
+// looked up, are returned separately with a warning rather than being archived.
+func confirmDeleted(getter RepoGetter, dir, id string, repos actions.Repos) (actions.Repos, actions.Repos) {
+	var reposToArchive actions.Repos
+
+	var reposToKeep actions.Repos
+
+	for _, repo := range repos {
+		// Only repos found locally but not in the repo list have no url
+		if repo.SSHURL != "" {
+			reposToArchive = append(reposToArchive, repo)
+			continue
+		}
+
+		namespace, ok := upstreamNamespace(dir, id, repo.Name)
+		if !ok {
+			repo.Severity = actions.Warning
+			repo.Message = "not archiving as unable to tell where it is upstream from its origin url"
+			reposToKeep = append(reposToKeep, repo)
+
+			continue
+		}
+
+		upstream, err := getter.GetRepo(namespace, actions.BaseName(repo.Name))
+
+		switch {
+		case err != nil:
+			repo.Severity = actions.Warning
+			repo.Message = fmt.Sprintf("not archiving as unable to confirm it was deleted upstream: %s", err)
+			reposToKeep = append(reposToKeep, repo)
+		case upstream == nil:
+			debug.Debugf("[%s] confirmed deleted upstream", repo.Name)
+			reposToArchive = append(reposToArchive, repo)
+		case upstream.Archived:
+			debug.Debugf("[%s] is archived upstream", repo.Name)
+			repo.Reason = actions.ReasonArchived
+			reposToArchive = append(reposToArchive, repo)
+		case !strings.EqualFold(upstream.Name, actions.BaseName(repo.Name)):
+			repo.Severity = actions.Warning
+			repo.Message = fmt.Sprintf("not archiving as it was renamed or transferred to %s upstream which was not in the repo list", upstreamName(upstream))
+			reposToKeep = append(reposToKeep, repo)
+		default:
+			repo.Severity = actions.Warning
+			repo.Message = "not archiving as it still exists upstream but was not in the repo list"
+			reposToKeep = append(reposToKeep, repo)
+		}
+	}
+
+	return reposToArchive, reposToKeep
+}
+
+// upstreamNamespace returns the namespace upstream of the local repo name. It is
+// part of the path of the repo with layouts other than flat, otherwise it is
+// taken from its origin url as the repo may be nested in subgroups of id.
+func upstreamNamespace(dir, id, name string) (string, bool) {
+	if namespace := actions.Layout(viper.GetString("layout")).Namespace(name); namespace != "" {
+		return namespace, true
+	}
+
+	url, err := actions.RemoteURL(context.Background(), filepath.Join(dir, name))
+	if err != nil {
+		return "", false
+	}
+
+	return namespaceFromURL(url, id)
+}
+
+// namespaceFromURL returns the namespace of the repo at url from id onwards,
+// which can be preceded by a prefix added by --clone-url-template. It reports
+// false if the repo isn't in id or a subgroup of it.
+func namespaceFromURL(url, id string) (string, bool) {
+	p := url
+	if i := strings.Index(p, "://"); i >= 0 {
+		// Drop the scheme and host
+		p = p[i+len("://"):]
+		if i = strings.Index(p, "/"); i >= 0 {
+			p = p[i:]
+		}
+	} else if i := strings.Index(p, ":"); i >= 0 {
+		p = p[i+1:]
+	}
+
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	owner := segments[:len(segments)-1]
+	idSegments := strings.Split(id, "/")
+
+	for i := 0; i+len(idSegments) <= len(owner); i++ {
+		if strings.EqualFold(strings.Join(owner[i:i+len(idSegments)], "/"), id) {
+			return strings.Join(owner[i:], "/"), true
+		}
+	}
+
+	return "", false
+}
+
+// upstreamName returns the full name of a repo looked up upstream
+func upstreamName(repo *actions.Repo) string {
+	if repo.Owner == "" {
+		return repo.Name
+	}
+
+	return repo.Owner + "/" + repo.Name
+}
+
+// archiveLimitError is returned when a plan would archive more repos than the
+// archive limits allow, which aborts the run rather than failing it
+type archiveLimitError struct {
+	error
+}
+
+// checkArchiveLimits returns an error if archiving repos would move more than
+// --max-archive or --max-archive-percent of the lenDirs existing repos.
+// Repos that are about to be cloned straight into the archive don't count.
+func checkArchiveLimits(reposToArchive, reposToClone actions.Repos, lenDirs int) error {
+	cloned := map[*actions.Repo]bool{}
+	for _, repo := range reposToClone {
+		cloned[repo] = true
+	}
+
+	n := 0
+
+	for _, repo := range reposToArchive {
+		if !cloned[repo] {
+			n++
+		}
+	}
+
+	maxArchive := viper.GetInt("max-archive")
+	if maxArchive > 0 && n > maxArchive {
+		return fmt.Errorf("%d existing repos would be archived which is more than --max-archive=%d", n, maxArchive)
+	}
+
+	maxPercent := viper.GetInt("max-archive-percent")
+	//nolint:gomnd
+	if maxPercent > 0 && n > minArchiveForPercent && n*100 > maxPercent*lenDirs {
+		return fmt.Errorf(
+			"%d of %d existing repos would be archived which is more than --max-archive-percent=%d",
+			n,
+			lenDirs,
+			maxPercent,
+		)
+	}
+
+	return nil
+}
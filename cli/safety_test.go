@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGetter holds repos by their namespace and name
+type fakeGetter map[string]*actions.Repo
+
+func (f fakeGetter) GetRepo(namespace, name string) (*actions.Repo, error) {
+	if name == "brokenRepo" {
+		return nil, errors.New("boom")
+	}
+
+	return f[namespace+"/"+name], nil
+}
+
+func TestConfirmDeleted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	origins := map[string]string{
+		"deletedRepo":  "git@github.com:foo/deletedRepo.git",
+		"existingRepo": "git@github.com:foo/existingRepo.git",
+		"archivedRepo": "git@github.com:foo/archivedRepo.git",
+		"brokenRepo":   "git@github.com:foo/brokenRepo.git",
+		"renamedRepo":  "git@github.com:foo/renamedRepo.git",
+		"nestedRepo":   "https://gitlab.com/foo/sub/nestedRepo.git",
+		"otherRepo":    "git@github.com:bar/otherRepo.git",
+	}
+	for repo, origin := range origins {
+		initRepo(t, dir+"/"+repo)
+		runGit(t, dir+"/"+repo, "remote", "add", "origin", origin)
+	}
+	initRepo(t, dir+"/noOrigin")
+
+	getter := fakeGetter{
+		"foo/existingRepo":   &actions.Repo{Name: "existingRepo", SSHURL: "git@giturl/existingRepo"},
+		"foo/archivedRepo":   &actions.Repo{Name: "archivedRepo", SSHURL: "git@giturl/archivedRepo", Archived: true},
+		"foo/renamedRepo":    &actions.Repo{Name: "newName", Owner: "bar", SSHURL: "git@giturl/newName"},
+		"foo/sub/nestedRepo": &actions.Repo{Name: "nestedRepo", SSHURL: "git@giturl/nestedRepo"},
+		// Not looked up as it isn't in foo
+		"bar/otherRepo": &actions.Repo{Name: "otherRepo", SSHURL: "git@giturl/otherRepo"},
+	}
+	listedRepo := &actions.Repo{Name: "listedRepo", SSHURL: "git@giturl/listedRepo", Archived: true}
+	repos := actions.Repos{
+		listedRepo,
+		&actions.Repo{Name: "deletedRepo", Reason: actions.ReasonDeleted},
+		&actions.Repo{Name: "existingRepo"},
+		&actions.Repo{Name: "archivedRepo", Reason: actions.ReasonDeleted},
+		&actions.Repo{Name: "brokenRepo"},
+		&actions.Repo{Name: "renamedRepo"},
+		&actions.Repo{Name: "nestedRepo"},
+		&actions.Repo{Name: "otherRepo"},
+		&actions.Repo{Name: "noOrigin"},
+	}
+
+	reposToArchive, reposToKeep := confirmDeleted(getter, dir, "foo", repos)
+	assert.Equal(t, actions.Repos{
+		listedRepo,
+		&actions.Repo{Name: "deletedRepo", Reason: actions.ReasonDeleted},
+		// Recorded as archived rather than deleted upstream
+		&actions.Repo{Name: "archivedRepo", Reason: actions.ReasonArchived},
+	}, reposToArchive)
+	assert.Equal(t, actions.Repos{
+		&actions.Repo{
+			Name:     "existingRepo",
+			Severity: actions.Warning,
+			Message:  "not archiving as it still exists upstream but was not in the repo list",
+		},
+		&actions.Repo{
+			Name:     "brokenRepo",
+			Severity: actions.Warning,
+			Message:  "not archiving as unable to confirm it was deleted upstream: boom",
+		},
+		&actions.Repo{
+			Name:     "renamedRepo",
+			Severity: actions.Warning,
+			Message:  "not archiving as it was renamed or transferred to bar/newName upstream which was not in the repo list",
+		},
+		&actions.Repo{
+			Name:     "nestedRepo",
+			Severity: actions.Warning,
+			Message:  "not archiving as it still exists upstream but was not in the repo list",
+		},
+		&actions.Repo{
+			Name:     "otherRepo",
+			Severity: actions.Warning,
+			Message:  "not archiving as unable to tell where it is upstream from its origin url",
+		},
+		&actions.Repo{
+			Name:     "noOrigin",
+			Severity: actions.Warning,
+			Message:  "not archiving as unable to tell where it is upstream from its origin url",
+		},
+	}, reposToKeep)
+}
+
+func TestConfirmDeletedLayout(t *testing.T) {
+	viper.Set("layout", string(actions.LayoutHost))
+	defer viper.Set("layout", string(actions.LayoutFlat))
+
+	getter := fakeGetter{
+		"foo/sub/docs": &actions.Repo{Name: "docs", SSHURL: "git@giturl/docs"},
+	}
+	repos := actions.Repos{
+		&actions.Repo{Name: "gitlab.com/foo/sub/docs"},
+		&actions.Repo{Name: "gitlab.com/foo/docs"},
+	}
+
+	// The namespace is taken from the path so the repos aren't read
+	reposToArchive, reposToKeep := confirmDeleted(getter, "/missing", "foo", repos)
+	assert.Equal(t, actions.Repos{&actions.Repo{Name: "gitlab.com/foo/docs"}}, reposToArchive)
+	assert.Equal(t, actions.Repos{
+		&actions.Repo{
+			Name:     "gitlab.com/foo/sub/docs",
+			Severity: actions.Warning,
+			Message:  "not archiving as it still exists upstream but was not in the repo list",
+		},
+	}, reposToKeep)
+}
+
+func TestNamespaceFromURL(t *testing.T) {
+	type testCase struct {
+		url               string
+		id                string
+		expectedNamespace string
+		expectedOK        bool
+	}
+	testCases := []testCase{
+		{url: "git@github.com:foo/repo.git", id: "foo", expectedNamespace: "foo", expectedOK: true},
+		{url: "git@github.com:Foo/repo.git", id: "foo", expectedNamespace: "Foo", expectedOK: true},
+		{url: "ssh://git@gitlab.com:2222/foo/sub/repo.git", id: "foo", expectedNamespace: "foo/sub", expectedOK: true},
+		{url: "https://gitlab.com/foo/sub/deeper/repo", id: "foo/sub", expectedNamespace: "foo/sub/deeper", expectedOK: true},
+		{url: "https://proxy.example.com/github/foo/repo.git", id: "foo", expectedNamespace: "foo", expectedOK: true},
+		{url: "git@github.com:bar/repo.git", id: "foo", expectedOK: false},
+		{url: "git@github.com:foo.git", id: "foo", expectedOK: false},
+	}
+	for _, tc := range testCases {
+		namespace, ok := namespaceFromURL(tc.url, tc.id)
+		assert.Equal(t, tc.expectedNamespace, namespace, tc.url)
+		assert.Equal(t, tc.expectedOK, ok, tc.url)
+	}
+}
+
+func TestCheckArchiveLimits(t *testing.T) {
+	defer viper.Set("max-archive", defaultMaxArchive)
+	defer viper.Set("max-archive-percent", defaultMaxArchivePercent)
+
+	var repos actions.Repos
+	for i := 0; i < 10; i++ {
+		repos = append(repos, &actions.Repo{})
+	}
+
+	viper.Set("max-archive", 9)
+	viper.Set("max-archive-percent", 0)
+	assert.EqualError(t, checkArchiveLimits(repos, nil, 100), "10 existing repos would be archived which is more than --max-archive=9")
+	assert.NoError(t, checkArchiveLimits(repos, repos[:1], 100), "repos cloned into the archive don't count")
+
+	viper.Set("max-archive", 0)
+	viper.Set("max-archive-percent", 10)
+	assert.EqualError(t, checkArchiveLimits(repos, nil, 99), "10 of 99 existing repos would be archived which is more than --max-archive-percent=10")
+	assert.NoError(t, checkArchiveLimits(repos, nil, 100))
+	assert.NoError(t, checkArchiveLimits(repos[:5], nil, 5), "small numbers of repos are always allowed")
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/mitchellh/colorstring"
+	"github.com/spf13/viper"
+)
+
+// resultGroup is a set of repos that had the same action run on them
+type resultGroup struct {
+	// action names the action in warnings and errors e.g. "Sync"
+	action string
+	// done names the action in the totals e.g. "synced". Groups without it
+	// are not counted.
+	done  string
+	color string
+	repos actions.Repos
+	// warningSkips is set when a warning means the action was skipped
+	warningSkips bool
+}
+
+// printSummary prints the warnings and errors of every group followed by the
+// totals for each group.
+func printSummary(groups ...resultGroup) {
+	printSeverity(actions.Warning, "[yellow]Warnings:", "yellow", groups)
+	printSeverity(actions.Error, "[red]Errors:", "red", groups)
+
+	if viper.GetBool("dry-run") {
+		return
+	}
+
+	fmt.Fprintln(out, "=============")
+
+	for _, g := range groups {
+		total := len(g.repos)
+		if g.done == "" || total == 0 {
+			continue
+		}
+
+		failures := countSeverity(g.repos, actions.Error)
+		if g.warningSkips {
+			failures += countSeverity(g.repos, actions.Warning)
+		}
+
+		if failures > 0 {
+			colorstring.Fprintf(out, "[red]%d[reset]/["+g.color+"]%d repos %s\n", total-failures, total, g.done)
+		} else {
+			colorstring.Fprintf(out, "["+g.color+"]%d/%d repos %s\n", total, total, g.done)
+		}
+	}
+}
+
+func printSeverity(severity actions.Severity, heading, color string, groups []resultGroup) {
+	printed := false
+
+	for _, g := range groups {
+		for _, repo := range g.repos {
+			if repo.Severity != severity {
+				continue
+			}
+
+			if !printed {
+				fmt.Fprintln(out, "=============")
+				//nolint:errcheck
+				colorstring.Fprintln(out, heading)
+
+				printed = true
+			}
+
+			// Only the format is parsed for colors so messages can contain brackets
+			colorstring.Fprintf(out, "["+g.color+"]%s %s: ["+color+"]%s\n", g.action, repo.Name, strings.TrimSuffix(repo.Message, "\n"))
+		}
+	}
+
+	if printed {
+		fmt.Fprintln(out, "=============")
+	}
+}
+
+func countSeverity(repos actions.Repos, severity actions.Severity) int {
+	n := 0
+
+	for _, repo := range repos {
+		if repo.Severity == severity {
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/mitchellh/colorstring"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var unarchiveCmd = &cobra.Command{
+	Use:   "unarchive [name] [download dir]",
+	Short: "Move a repo back from the archive dir and sync it",
+	Example: `To restore foobar from ~/download/dir/.archive
+> git-mass-sync unarchive foobar ~/download/dir`,
+	//nolint:gomnd
+	Args:        cobra.ExactArgs(2),
+	Annotations: map[string]string{targetDirArg: "1"},
+	Run: func(cmd *cobra.Command, args []string) {
+		os.Exit(runUnarchive(args[0], args[1]))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(unarchiveCmd)
+
+	unarchiveCmd.Flags().String("archive-dir", "", "Dir the repo was archived in\n(default is .archive in the download dir)")
+}
+
+// restoreArchived finds repos about to be cloned that are in the archive dir
+// because they were archived or deleted upstream and have since come back.
+// It returns the repos still to clone and the repos to unarchive instead.
+func restoreArchived(archiveDir string, reposToClone actions.Repos) (actions.Repos, actions.Repos) {
+	var clone, unarchive actions.Repos
+
+	for _, repo := range reposToClone {
+		archived := filepath.Join(archiveDir, repo.Name)
+
+		// Repos that are still archived upstream are cloned into the archive
+		if repo.Archived || !actions.IsGitDir(archived) {
+			clone = append(clone, repo)
+			continue
+		}
+
+		// A new repo with the name of one that was deleted
+		if id := actions.RepoID(context.Background(), archived); id != "" && repo.ID != "" && id != repo.ID {
+			clone = append(clone, repo)
+			continue
+		}
+
+		unarchive = append(unarchive, repo)
+	}
+
+	return clone, unarchive
+}
+
+func runUnarchive(name, dir string) int {
+	dir = filepath.Clean(dir)
+
+	archiveDir := viper.GetString("archive-dir")
+	if archiveDir == "" {
+		archiveDir = fmt.Sprintf("%s/.archive", dir)
+	} else {
+		archiveDir = filepath.Clean(archiveDir)
+	}
+
+	if !actions.IsGitDir(filepath.Join(archiveDir, name)) {
+		colorstring.Fprintf(out, "[red]%s is not a git repo in %s\n", name, archiveDir)
+		return exitError
+	}
+
+	plan := &syncPlan{
+		dir:        dir,
+		archiveDir: archiveDir,
+		unarchive:  actions.Repos{{Name: name}},
+		sync:       actions.Repos{{Name: name}},
+	}
+
+	return plan.execute()
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lhopki01/git-mass-sync/actions"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreArchived(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-mass-sync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, repo := range []string{"restored", "noID", "replaced", "archived", "foo/owned"} {
+		initRepo(t, dir+"/"+repo)
+	}
+	runGit(t, dir+"/restored", "config", "gms.id", "github.com/1")
+	runGit(t, dir+"/replaced", "config", "gms.id", "github.com/2")
+	assert.NoError(t, os.Mkdir(dir+"/notGitDir", 0755))
+
+	restored := &actions.Repo{Name: "restored", ID: "github.com/1"}
+	noID := &actions.Repo{Name: "noID", ID: "github.com/3"}
+	replaced := &actions.Repo{Name: "replaced", ID: "github.com/4"}
+	archived := &actions.Repo{Name: "archived", Archived: true}
+	owned := &actions.Repo{Name: "foo/owned"}
+	notGitDir := &actions.Repo{Name: "notGitDir"}
+	newRepo := &actions.Repo{Name: "newRepo"}
+
+	clone, unarchive := restoreArchived(dir, actions.Repos{restored, noID, replaced, archived, owned, notGitDir, newRepo})
+
+	assert.Equal(t, actions.Repos{replaced, archived, notGitDir, newRepo}, clone)
+	assert.Equal(t, actions.Repos{restored, noID, owned}, unarchive)
+}
@@ -21,5 +21,5 @@ func init() {
 }
 
 func runVersion() {
-	fmt.Println(Version)
+	fmt.Fprintln(out, Version)
 }